@@ -10,6 +10,12 @@ type Cache struct {
 	lock  *sync.Mutex
 }
 
+// Transient is implemented by results that are passed to the callers waiting for them, but not kept in the cache.
+// A later lookup of the key calls the factory again.
+type Transient interface {
+	Transient() bool
+}
+
 type cacheObject struct {
 	result  interface{}
 	futures []chan interface{}
@@ -26,8 +32,13 @@ func NewCache() *Cache {
 }
 
 func (c *Cache) register(key string, value interface{}) {
-	e := c.lookup(key)
-	if e != nil {
+	c.lock.Lock()
+	e, ok := c.cache[key]
+	if tr, isTransient := value.(Transient); ok && isTransient && tr.Transient() {
+		delete(c.cache, key)
+	}
+	c.lock.Unlock()
+	if ok {
 		e.lock.Lock()
 		defer e.lock.Unlock()
 		e.result = value
@@ -38,15 +49,6 @@ func (c *Cache) register(key string, value interface{}) {
 	}
 }
 
-func (c *Cache) lookup(key string) *cacheObject {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	if e, ok := c.cache[key]; ok {
-		return e
-	}
-	return nil
-}
-
 // Lookup checks for the cached object. If none is found, the factory will be called. Returns a channel to receive the result from.
 func (c *Cache) Lookup(key string, factory func() interface{}) chan interface{} {
 	c.lock.Lock()
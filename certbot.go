@@ -0,0 +1,114 @@
+package certexpire
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CertbotDir is the configuration directory of certbot, used by the certbot protocol if param is empty.
+const CertbotDir = "/etc/letsencrypt"
+
+// certbotFiles are the keys of a renewal configuration that refer to the files of the lineage.
+var certbotFiles = []string{"cert", "privkey", "chain", "fullchain"}
+
+// parseCertbotRenewal returns the settings before the first section of a certbot renewal configuration.
+func parseCertbotRenewal(d []byte) (map[string]string, error) {
+	settings := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(d))
+	for n := 1; s.Scan(); n++ {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		if l[0] == '[' {
+			break
+		}
+		p := strings.IndexByte(l, '=')
+		if p < 0 {
+			return nil, fmt.Errorf("line %d: format error", n)
+		}
+		settings[strings.TrimSpace(l[:p])] = strings.TrimSpace(l[p+1:])
+	}
+	return settings, s.Err()
+}
+
+// getCertbotLineage verifies the renewal configuration of one lineage and loads its certificate.
+func getCertbotLineage(conf string) (*CertValues, error) {
+	d, err := ioutil.ReadFile(conf)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := parseCertbotRenewal(d)
+	if err != nil {
+		return nil, fmt.Errorf("certexpire: certbot: %s: %s", conf, err)
+	}
+	for _, k := range certbotFiles {
+		path, ok := settings[k]
+		if !ok || path == "" {
+			return nil, fmt.Errorf("certexpire: certbot: %s: %s missing", conf, k)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(conf), path)
+			settings[k] = path
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("certexpire: certbot: %s: %s", conf, err)
+		}
+	}
+	d, err = ioutil.ReadFile(settings["cert"])
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parsePEM(d)
+	if err != nil {
+		return nil, err
+	}
+	return verifyCerts("", certs, false), nil
+}
+
+// GetCertCertbot returns the certificates of all certbot lineages in the configuration directory dir,
+// one result per lineage.
+func GetCertCertbot(servername, dir string) []FetchResult {
+	return getCertCertbot(context.Background(), &Target{Hostname: servername, Param: dir})
+}
+
+// getCertCertbot reads the renewal configurations in t.Param, or CertbotDir if empty, and loads the certificate
+// of each lineage. Results are named by lineage. Broken configurations and missing files are reported as errors
+// of their lineage. The certificates are only checked for expiry.
+func getCertCertbot(ctx context.Context, t *Target) []FetchResult {
+	dir := t.Param
+	if dir == "" {
+		dir = CertbotDir
+	}
+	confs, err := filepath.Glob(filepath.Join(dir, "renewal", "*.conf"))
+	if err == nil && len(confs) == 0 {
+		err = fmt.Errorf("certexpire: certbot: no renewal configuration in %s", dir)
+	}
+	if err != nil {
+		return []FetchResult{{Values: &CertValues{Hostname: t.Hostname}, Err: err}}
+	}
+	r := make([]FetchResult, len(confs))
+	for i, conf := range confs {
+		r[i].Name = strings.TrimSuffix(filepath.Base(conf), ".conf")
+		if err := ctx.Err(); err != nil {
+			r[i].Err = err
+			continue
+		}
+		r[i].Values, r[i].Err = getCertbotLineage(conf)
+		if r[i].Values == nil {
+			r[i].Values = &CertValues{}
+		}
+		r[i].Values.Hostname = t.Hostname
+	}
+	return r
+}
+
+func init() {
+	RegisterProtocol("certbot", MultiFetcherFunc(getCertCertbot))
+}
@@ -0,0 +1,51 @@
+package certexpire
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCertCertbot(t *testing.T) {
+	r := GetCertCertbot("example.com", "testdata/letsencrypt")
+	if len(r) != 3 {
+		t.Fatalf("got %d results, want 3: %+v", len(r), r)
+	}
+	tests := []struct {
+		name string
+		err  string // Part of the error, empty for none.
+	}{
+		{"broken.example.com", "line 3: format error"},
+		{"nocert.example.com", "cert.pem"},
+		{"www.example.com", ""},
+	}
+	for i, test := range tests {
+		res := r[i]
+		if res.Name != test.name {
+			t.Errorf("result %d: got name %q, want %q", i, res.Name, test.name)
+		}
+		if test.err == "" && res.Err != nil {
+			t.Errorf("%s: %s", test.name, res.Err)
+		}
+		if test.err != "" && (res.Err == nil || !strings.Contains(res.Err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.name, res.Err, test.err)
+		}
+		if res.Values == nil || res.Values.Hostname != "example.com" {
+			t.Errorf("%s: got values %+v", test.name, res.Values)
+		}
+	}
+	if cv := r[2].Values; cv.VerifyError != nil || !cv.Expire.Equal(time.Date(2049, 6, 30, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("www.example.com: got %+v", cv)
+	}
+
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if r := GetCertCertbot("example.com", dir); len(r) != 1 || r[0].Err == nil || r[0].Name != "" {
+		t.Errorf("empty directory: got %+v", r)
+	}
+}
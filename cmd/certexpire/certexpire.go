@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
@@ -76,7 +78,16 @@ func main() {
 		os.Exit(3)
 	}
 
-	report.Generate(config)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+	report.GenerateContext(ctx, config)
+	signal.Stop(sigChan)
+	cancel()
 
 	os.Exit(report.Logger.Stop())
 }
@@ -85,25 +96,101 @@ var newhelp = `# certexpire
 
 certexpire is a tool to check the expiration date (NotAfter) and optionally the hash of x509 certificates.
 These certificates can be loaded from file, the standard output of a program, or from the network.
-Network protocols supported are direct TLS/SSL connections over TCP, as well as IMAP and SMTP with STARTTLS.
+Network protocols supported are direct TLS/SSL connections over TCP, as well as protocols that negotiate TLS in-band (STARTTLS), like IMAP, POP3, SMTP, LMTP, FTP, NNTP, ManageSieve, LDAP, XMPP, PostgreSQL, MySQL, Microsoft SQL Server and RDP.
 
 Certificate checks are defined in a configuration file that understand several commands.
 Each line defines one command. Lines starting with # are comments.
 
 == 
 The standard test command looks like:
-  hostname:param:protocol:deadline:<hash>
+  hostname:param:protocol:deadline:<hash>:<option=value>...
 
 hostname refers both to network connection hostname as well as owner of certificate.
+IPv6 addresses must be enclosed in brackets, e.g. [2001:db8::1]:443:tls:10d. This applies to the hostname, the addr
+option, the proxy and the mail server.
+Fields can be enclosed in double quotes, and single characters escaped with a backslash. Quoted text may contain
+colons, # and whitespace, and keeps its case. Example:
+  example.com:"openssl x509 -in /etc/ssl/Example.pem":command:10d
 param refers to the parameter used for this check, it depends on the protocol. Supported protocols are:
   ssl or tls: Direct TLS/SSL connection over TCP. Param must contain the port number.
   imap: STARTTLS for IMAP. Param is the port number.
+  pop3: STLS for POP3. Param is the port number.
   smtp: STARTTLS for SMTP. Param is the port number.
-  file: Load certificate from a file. Param is the path to the file.
-  command: Load certificate from the standard output of a command. Param is the command to run.
+  lmtp: STARTTLS for LMTP. Param is the port number.
+  ftp: AUTH TLS for FTP (explicit FTPS). Param is the port number.
+  nntp: STARTTLS for NNTP. Param is the port number.
+  sieve: STARTTLS for ManageSieve. Param is the port number.
+  postgres: SSLRequest for PostgreSQL. Param is the port number.
+  mysql: SSL request for MySQL and MariaDB. Param is the port number.
+  mssql: TDS PRELOGIN for Microsoft SQL Server. Param is the port number.
+  rdp: X.224 negotiation for the Remote Desktop Protocol. Param is the port number.
+  ldap: StartTLS extended operation for LDAP. Param is the port number.
+  xmpp-client, xmpp-server: STARTTLS for XMPP client and server-to-server streams. Param is the port number.
+  file: Load certificate from a file. Param is the path to the file. Files may contain several certificates,
+        like full chains or CA bundles. Each is checked for expiry, the first is the leaf. PEM, DER, PKCS#7 (.p7b)
+        and PKCS#12 (.pfx, .p12) files are recognized.
+  command: Load certificate from the standard output of a command. Param is the command to run. It is split into
+           arguments at whitespace, single and double quotes group words like in the shell. The output may be in
+           any format the file protocol recognizes.
+  jks: Load the certificates of a Java keystore (JKS or JCEKS). Param is the path to the keystore. Each entry is
+       reported by its alias, as hostname:param@alias. The chains of private key entries are verified for hostname,
+       trusted certificates are only checked for expiry. With password-env or password-file, the integrity of the
+       keystore is verified with the password. Secret key entries of JCEKS keystores are not supported: the entry
+       is reported as an error, and the entries after it and the integrity of the keystore are not checked.
+  dir: Load the certificates of all files in a directory, walked recursively. Param is the directory or a glob
+       pattern like /etc/ssl/private/*.pem. Each certificate is reported with the path of its file as param, and
+       its position as hostname:path@position for files with several certificates. Files without certificates
+       are skipped, files that fail to parse are reported as errors. The certificates are only checked for expiry,
+       not verified for hostname.
+  certbot: Check all certificates managed by certbot (Let's Encrypt). Param is the certbot configuration directory,
+           /etc/letsencrypt if empty. For each renewal/*.conf, the certificate its cert setting points to is loaded
+           and reported by lineage, as hostname:param@lineage. Broken renewal configurations and missing cert,
+           privkey, chain or fullchain files are reported as errors of the lineage. A single line covers all
+           lineages of a host: example.com::certbot:14d
+  k8s-secret: Check the Kubernetes secrets of type kubernetes.io/tls in a YAML or JSON manifest file. Param is the
+              path to the file, or with exec=true a command like "kubectl get secret -A -o json" whose output is
+              read. Each secret is reported as hostname:param@namespace/name. For cert-manager Certificate
+              resources, status.notAfter must match the certificate in their secret. The certificates are only
+              checked for expiry.
 deadline is the warning duration before certificate expiration. Understands s/m/d.
+For network protocols, the deadline applies to every certificate the server sends and to the verified chain up to
+the root. Warnings name the expiring certificate by its position in the chain and its subject.
 hash is optional, and is the sha512 hash of the certificate. Use certexpire with verbosity level 1 or over to
 learn the hash.
+options are optional, and modify how the certificate is retrieved. Supported options are:
+  addr=address  Connect to address instead of hostname, e.g. to check one node behind a load balancer.
+                The port is taken from param, unless address includes one: addr=[2001:db8::1]:8443.
+  sni=name      Send name as TLS server name (SNI) and verify the certificate for it instead of hostname.
+                An empty "sni=" sends no server name at all, to see the server's default certificate.
+  addrs=all     Resolve the host and check every address it resolves to, with one result per address.
+                Addresses that serve a certificate differing from the majority are reported, all of them if
+                there is no majority. Default is addrs=one. Only for network protocols. The host is resolved
+                locally, so addrs=all cannot be used with a proxy.
+  shell=true    Run the command of the command protocol with "sh -c" instead of splitting it into arguments.
+  env=NAME=val  Add NAME to the environment of the command. Can be given several times.
+  exec=true     For k8s-secret, run param as command and read its output instead of a file.
+  leaf=hostname For files with several certificates, use the certificate valid for hostname as the leaf, which is
+                verified and hashed. Default is leaf=first.
+  format=pem    Format of the file or command output: auto, pem, der, pkcs7 (p7b) or pkcs12 (pfx, p12). Default is
+                format=auto, which detects the format.
+  password-env=NAME   Read the password of PKCS#12 files and keystores from the environment variable NAME.
+  password-file=path  Read the password of PKCS#12 files and keystores from the first line of file path.
+                Without either, an empty password is used.
+  ca=path       Verify network certificates with the CA bundle file path, instead of the one set by ^cafile.
+  trust=append  How network certificates are verified: append adds the CA file to the system roots, replace uses
+                only the CA file, system uses only the system roots, none skips chain verification while still
+                checking expiry, hostname and hash. Default is trust=append.
+  pin=value     Require the certificate to match the pin. Can be given several times, to pre-stage rotations;
+                any of them must match. Mismatches are reported with the certificate's pin values.
+  pintype=spki  What pins are compared with: spki is the base64 SHA-256 of the leaf's public key (HPKP-style,
+                optionally prefixed with sha256//), which survives renewals that keep the key. issuer is the same
+                for any issuer or intermediate in the chain. cert is the sha512 hash of the leaf, like hash.
+                Default is pintype=spki.
+  ocsp=on       Check the revocation status of network certificates with OCSP. The response stapled by the server
+                is used if present, otherwise the OCSP responder of the certificate is asked, through the proxy of
+                the check. Revoked and unknown status are reported. ocsp=staple also reports a missing stapled
+                response. Default is ocsp=off.
+  ocspdeadline=1d  Warning duration before a stapled OCSP response expires. Understands s/m/d. Default is 1d.
 
 ==
 certexpire can send warnings via email. The following line defines the outgoing email settings to use.
@@ -112,6 +199,9 @@ certexpire can send warnings via email. The following line defines the outgoing
 mailserver is the SMTP server to connect to, at port.
 from is the sender address for all emails.
 username and password are used for authentication (only LOGIN is supported).
+The fields of this line are taken as written, backslashes and quotes within them are not special. A field that
+contains colons or # must be enclosed in double quotes as a whole, e.g. "pass:word". Within such a field, \" and
+\\ stand for " and \.
 
 ==
 certexpire will send the warnings for checks only if a receiving email address is defined.
@@ -129,6 +219,16 @@ certexpire also supports SOCKS5 connections for its checks. The setting applies
 proxyaddress is the hostname:port of a SOCKS5 server.
 Set proxyaddress to "direct" to disable a previous proxy configuration.
 
+==
+Network certificates are verified against the system roots. For private CAs, a CA bundle file can be set for
+all following checks.
+
+  ^cafile
+
+cafile is the path to a file with the CA certificates, in any format the file protocol recognizes. By default,
+they are added to the system roots, see the trust option. Set cafile to "system" to disable a previous CA file.
+A cafile that does not exist is a parse error.
+
 ==
 The exit code of certexpire is meaningful. It returns:
 
@@ -161,7 +261,7 @@ Subject: SSL certificates check failed
 The following servers have failed the TLS certificate check:
 {{ range $e := .Report.Checks }}
 {{- if or $e.Error $e.ExecuteError }}
-{{ $e.Hostname }}:{{ $e.Param}} ({{$e.Protocol}}): Expires {{ $e.ExpireTime }}
+{{ $e.Hostname }}:{{ $e.Param}}{{ if $e.Source }}@{{ $e.Source }}{{ end }} ({{$e.Protocol}}): Expires {{ $e.ExpireTime }}
 {{ if $e.Error -}} {{- range $err := $e.Error }} ==> {{ $err}} {{- end}} {{- end}} 
 {{ if $e.ExecuteError -}} ==> ({{$e.ExecuteError}}) {{- end -}} 
 {{- end -}}
@@ -178,8 +278,10 @@ Data available for the check result are:
  Hash,            string: The expected/configured certificate hash.
  ReturnHash,      string: The actual hash returned by the check.
  Error,          []error: List of verification errors.
- ExecuteError,     error: If there was an error on retrieving the certificate.
- ExpireTime,   time.Time: The certificate's NotAfter.
+ ExecuteError,     error: If there was an error on retrieving the certificate. Includes the standard error of
+                          failed commands.
+ ExpireTime,   time.Time: The certificate's NotAfter. For several certificates, the earliest NotAfter.
+ Source,          string: Source of the result for checks with several results, e.g. the address.
 
 
 
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url                      string
+		servername, param, proto string
+		addr                     string
+	}{
+		{"tls://example.com:443/", "example.com", "443", "tls", "example.com:443"},
+		{"https://[2001:db8::1]:8443/", "2001:db8::1", "8443", "https", "[2001:db8::1]:8443"},
+		{"smtp://[::1]:25", "::1", "25", "smtp", "[::1]:25"},
+		{"file:///etc/ssl/cert.pem", "", "/etc/ssl/cert.pem", "file", ""},
+		{"/etc/ssl/cert.pem", "", "/etc/ssl/cert.pem", "file", ""},
+	}
+	for _, test := range tests {
+		servername, param, proto, err := parseURL(test.url)
+		if err != nil {
+			t.Errorf("%s: %s", test.url, err)
+			continue
+		}
+		if servername != test.servername || param != test.param || proto != test.proto {
+			t.Errorf("%s: got %q %q %q", test.url, servername, param, proto)
+		}
+		// GetCert dials servername and param joined like this.
+		if test.addr != "" {
+			if addr := net.JoinHostPort(servername, param); addr != test.addr {
+				t.Errorf("%s: got address %s, want %s", test.url, addr, test.addr)
+			}
+		}
+	}
+}
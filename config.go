@@ -3,6 +3,7 @@ package certexpire
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 	"unicode"
@@ -15,11 +16,14 @@ type ServerCheck struct {
 	Deadline     time.Duration
 	Hash         string
 	ReturnHash   string
+	ReturnPin    string // Pin values of the certificate, if the check has pins.
 	Error        []error
 	ExecuteError error
 	ExpireTime   time.Time
 	Proxy        *Proxy
-	KeyS, KeyC   int // used internally
+	Options      Options
+	Source       string // Source of this result for checks with several results, e.g. the address.
+	KeyS, KeyC   int    // used internally
 }
 
 type Proxy struct {
@@ -36,38 +40,181 @@ func ParseProxyLine(l string) *Proxy {
 	}
 }
 
+// ParseCALine returns the CA bundle file of a CA line. "system" returns an empty path, for the system roots only.
+func ParseCALine(l string) (string, error) {
+	fs := splitFields(l)
+	if len(fs) != 1 || fs[0].text == "" {
+		return "", errors.New("format error")
+	}
+	if !fs[0].quoted && cleanline(fs[0].text) == "system" {
+		return "", nil
+	}
+	return fs[0].text, nil
+}
+
 func (sc ServerCheck) Copy() ServerCheck {
 	return sc
 }
 
+// Target returns the retrieval target of the check.
+func (sc *ServerCheck) Target() *Target {
+	return &Target{
+		Hostname: sc.Hostname,
+		Param:    sc.Param,
+		Protocol: sc.Protocol,
+		Proxy:    sc.Proxy,
+		Options:  sc.Options,
+	}
+}
+
 func cleanline(s string) string {
 	return strings.ToLower(strings.TrimFunc(s, unicode.IsSpace))
 }
 
+// configField is a field of a configuration line.
+type configField struct {
+	text   string
+	quoted bool // The field contains quoted or escaped characters, which are taken literally.
+}
+
+// splitFields splits a configuration line at colons. Text in double quotes and characters escaped with a backslash
+// are taken literally, which allows colons, # and whitespace in fields. Unquoted whitespace around fields is removed.
+// A hostname in brackets, as in IPv6 literals, may contain colons, and so may an addr= value in brackets together
+// with its port: addr=[2001:db8::1]:8443.
+func splitFields(l string) []configField {
+	var (
+		fs                       []configField
+		f                        configField
+		b, space                 strings.Builder
+		inQuote, escape, bracket bool
+	)
+	write := func(c rune, literal bool) {
+		if !literal && unicode.IsSpace(c) {
+			if b.Len() > 0 {
+				space.WriteRune(c)
+			}
+			return
+		}
+		b.WriteString(space.String())
+		space.Reset()
+		b.WriteRune(c)
+	}
+	rs := []rune(l)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case escape:
+			write(c, true)
+			f.quoted, escape = true, false
+		case c == '\\':
+			escape = true
+		case c == '"':
+			inQuote = !inQuote
+			f.quoted = true
+		case inQuote:
+			write(c, true)
+		case bracket:
+			write(c, false)
+			if c == ']' {
+				bracket = false
+				if len(fs) > 0 {
+					// The port of an addr= value.
+					n := portLen(rs[i+1:])
+					for _, c := range rs[i+1 : i+1+n] {
+						write(c, false)
+					}
+					i += n
+				}
+			}
+		case c == ':':
+			f.text = b.String()
+			fs = append(fs, f)
+			f = configField{}
+			b.Reset()
+			space.Reset()
+		default:
+			if c == '[' && !f.quoted {
+				if len(fs) == 0 {
+					bracket = b.Len() == 0
+				} else if p := strings.IndexByte(b.String(), '='); p >= 0 {
+					bracket = cleanline(b.String()[:p]) == "addr" && b.Len() == p+1
+				}
+			}
+			write(c, false)
+		}
+	}
+	f.text = b.String()
+	return append(fs, f)
+}
+
+// portLen returns the length of a port number preceded by a colon at the start of rs, or 0 if there is none.
+func portLen(rs []rune) int {
+	if len(rs) < 2 || rs[0] != ':' {
+		return 0
+	}
+	n := 1
+	for n < len(rs) && rs[n] >= '0' && rs[n] <= '9' {
+		n++
+	}
+	if n == 1 || (n < len(rs) && rs[n] != ':' && !unicode.IsSpace(rs[n])) {
+		return 0
+	}
+	return n
+}
+
+// value returns the text of the field. Unquoted fields are converted to lower case.
+func (f configField) value() string {
+	if f.quoted {
+		return f.text
+	}
+	return strings.ToLower(f.text)
+}
+
+// unbracket removes the brackets around an IPv6 literal.
+func unbracket(s string) string {
+	if len(s) > 1 && s[0] == '[' && s[len(s)-1] == ']' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
 func ParseServerLine(l string) (*ServerCheck, error) {
 	var err error
-	// hostname:port:proto:deadline
-	fs := strings.Split(l, ":")
-	if len(fs) < 4 || len(fs) > 5 {
+	// hostname:port:proto:deadline:hash:option=value...
+	fs := splitFields(l)
+	if len(fs) < 4 {
 		return nil, errors.New("format error")
 	}
 	sc := &ServerCheck{
-		Hostname: cleanline(fs[0]),
-		Param:    cleanline(fs[1]),
-		Protocol: cleanline(fs[2]),
+		Hostname: unbracket(cleanline(fs[0].text)),
+		Param:    fs[1].value(),
+		Protocol: cleanline(fs[2].text),
 	}
-	sc.Deadline, err = ParseDuration(cleanline(fs[3]))
+	sc.Deadline, err = ParseDuration(cleanline(fs[3].text))
 	if err != nil {
 		return nil, err
 	}
-	switch sc.Protocol {
-	case "ssl", "tls", "imap", "smtp", "file", "command":
-		break
-	default:
+	if _, ok := LookupProtocol(sc.Protocol); !ok {
 		return nil, errors.New("unknown protocol")
 	}
-	if len(fs) == 5 {
-		sc.Hash = cleanline(fs[4])
+	for i, f := range fs[4:] {
+		if p := strings.IndexByte(f.text, '='); p >= 0 {
+			value := f.text[p+1:]
+			if !f.quoted {
+				value = strings.TrimFunc(value, unicode.IsSpace)
+			}
+			if err := sc.Options.Set(cleanline(f.text[:p]), value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if i > 0 {
+			return nil, errors.New("format error")
+		}
+		sc.Hash = cleanline(f.text)
+	}
+	if sc.Options.AllAddrs && localProtocols[sc.Protocol] {
+		return nil, errors.New("addrs=all needs a network protocol")
 	}
 	return sc, nil
 }
@@ -90,18 +237,80 @@ func (sc *SMTPConfig) Copy() *SMTPConfig {
 	}
 }
 
+// splitSMTPFields splits the mail server line at colons, up to a # that starts a comment. Unlike splitFields,
+// fields are taken as written, without escapes. Only a field enclosed in double quotes as a whole may contain
+// colons and #, with \" and \\ standing for " and \. A hostname in brackets, as in IPv6 literals, may contain colons.
+func splitSMTPFields(l string) []string {
+	var fs []string
+	for {
+		t := strings.TrimLeftFunc(l, unicode.IsSpace)
+		if v, rest, ok := quotedField(t); ok {
+			fs = append(fs, v)
+			if rest == "" {
+				return fs
+			}
+			l = rest[1:]
+			continue
+		}
+		var end int
+		if len(fs) == 0 && strings.HasPrefix(t, "[") {
+			end = strings.IndexByte(t, ']') + 1
+		}
+		p := strings.IndexAny(t[end:], ":#")
+		if p < 0 {
+			return append(fs, strings.TrimFunc(t, unicode.IsSpace))
+		}
+		fs = append(fs, strings.TrimFunc(t[:end+p], unicode.IsSpace))
+		if t[end+p] == '#' {
+			return fs
+		}
+		l = t[end+p+1:]
+	}
+}
+
+// quotedField returns the content of the double quoted field at the start of s, and the rest of s starting with the
+// colon after the field, or empty at the end of s or a comment. ok is false unless s starts with a quoted field
+// that ends at a colon, a comment or the end of s.
+func quotedField(s string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			rest = strings.TrimLeftFunc(s[i+1:], unicode.IsSpace)
+			if rest == "" || rest[0] == '#' {
+				return b.String(), "", true
+			}
+			if rest[0] != ':' {
+				return "", "", false
+			}
+			return b.String(), rest, true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
+
 func ParseSMTPLine(l string) (*SMTPConfig, error) {
-	// =hostname:port:from:"username":"password"
-	fs := strings.Split(l, ":")
+	// =hostname:port:from:username:password
+	fs := splitSMTPFields(l)
 	if len(fs) != 5 {
 		return nil, errors.New("format error")
 	}
 	sc := &SMTPConfig{
-		Hostname: cleanline(fs[0]),
+		Hostname: unbracket(cleanline(fs[0])),
 		Port:     cleanline(fs[1]),
 		From:     cleanline(fs[2]),
-		Username: strings.TrimFunc(fs[3], unicode.IsSpace),
-		Password: strings.TrimFunc(fs[4], unicode.IsSpace),
+		Username: fs[3],
+		Password: fs[4],
 	}
 	return sc, nil
 }
@@ -118,10 +327,20 @@ type Config struct {
 	Mail  *SMTPConfig
 }
 
+// removeComment removes everything from the first # that is neither quoted nor escaped.
 func removeComment(s string) string {
-	p := strings.IndexByte(s, '#')
-	if p >= 0 {
-		return s[p:]
+	var inQuote, escape bool
+	for i, c := range s {
+		switch {
+		case escape:
+			escape = false
+		case c == '\\':
+			escape = true
+		case c == '"':
+			inQuote = !inQuote
+		case c == '#' && !inQuote:
+			return s[:i]
+		}
 	}
 	return s
 }
@@ -129,6 +348,7 @@ func removeComment(s string) string {
 func ParseConfig(l string) (*Config, []string, error) {
 	var hasMail bool
 	var proxy *Proxy
+	var caFile string
 	ret := &Config{
 		Tests: make([]ConfigEntry, 0, 1),
 	}
@@ -136,7 +356,12 @@ func ParseConfig(l string) (*Config, []string, error) {
 	lines := strings.Split(l, "\n")
 LineLoop:
 	for i, l := range lines {
-		l = strings.TrimFunc(removeComment(l), unicode.IsSpace)
+		if strings.HasPrefix(strings.TrimLeftFunc(l, unicode.IsSpace), "=") {
+			// The mail server line has no escapes, splitSMTPFields removes its comment.
+			l = strings.TrimFunc(l, unicode.IsSpace)
+		} else {
+			l = strings.TrimFunc(removeComment(l), unicode.IsSpace)
+		}
 		if len(l) == 0 {
 			continue LineLoop
 		}
@@ -148,6 +373,21 @@ LineLoop:
 			proxy = ParseProxyLine(l[1:])
 			continue LineLoop
 		}
+		if l[0] == '^' {
+			f, err := ParseCALine(l[1:])
+			if err != nil {
+				errorList = append(errorList, fmt.Sprintf("Parse error line %d: %s", i+1, err))
+				continue LineLoop
+			}
+			if f != "" {
+				if _, err := os.Stat(f); err != nil {
+					errorList = append(errorList, fmt.Sprintf("Parse error line %d: %s", i+1, err))
+					continue LineLoop
+				}
+			}
+			caFile = f
+			continue LineLoop
+		}
 		if l[0] == '=' {
 			c, err := ParseSMTPLine(l[1:])
 			if err != nil {
@@ -176,7 +416,14 @@ LineLoop:
 			errorList = append(errorList, fmt.Sprintf("Parse error line %d: %s", i+1, err))
 			continue LineLoop
 		}
+		if sl.Options.AllAddrs && proxy != nil {
+			errorList = append(errorList, fmt.Sprintf("Parse error line %d: addrs=all cannot be used with a proxy", i+1))
+			continue LineLoop
+		}
 		sl.Proxy = proxy
+		if sl.Options.CAFile == "" {
+			sl.Options.CAFile = caFile
+		}
 		sl.KeyS = len(ret.Tests) - 1
 		sl.KeyC = len(ret.Tests[len(ret.Tests)-1].Checks)
 		ret.Tests[len(ret.Tests)-1].Checks = append(ret.Tests[len(ret.Tests)-1].Checks, *sl)
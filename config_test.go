@@ -0,0 +1,213 @@
+package certexpire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	tests := []struct {
+		line   string
+		fields []configField
+	}{
+		{"example.com:443:tls:10d", []configField{{"example.com", false}, {"443", false}, {"tls", false}, {"10d", false}}},
+		{" [2001:db8::1] :443", []configField{{"[2001:db8::1]", false}, {"443", false}}},
+		{"h:1:tls:1d:addr=[2001:db8::1]:8443", []configField{{"h", false}, {"1", false}, {"tls", false}, {"1d", false}, {"addr=[2001:db8::1]:8443", false}}},
+		{"h:1:tls:1d:addr=[2001:db8::1]:sni=x", []configField{{"h", false}, {"1", false}, {"tls", false}, {"1d", false}, {"addr=[2001:db8::1]", false}, {"sni=x", false}}},
+		{"h:1:tls:1d:addr = [::1]:8443 :sni=x", []configField{{"h", false}, {"1", false}, {"tls", false}, {"1d", false}, {"addr = [::1]:8443", false}, {"sni=x", false}}},
+		{"h:1:tls:1d:addr=[::1]:84x", []configField{{"h", false}, {"1", false}, {"tls", false}, {"1d", false}, {"addr=[::1]", false}, {"84x", false}}},
+		// Brackets elsewhere are ordinary characters.
+		{"h:/tmp/a[1:file:1d", []configField{{"h", false}, {"/tmp/a[1", false}, {"file", false}, {"1d", false}}},
+		{"h:1:tls:1d:sni=[x:y]", []configField{{"h", false}, {"1", false}, {"tls", false}, {"1d", false}, {"sni=[x", false}, {"y]", false}}},
+		{"h[:1", []configField{{"h[", false}, {"1", false}}},
+		// Quotes and escapes.
+		{`h:"a:b # C":command:1d`, []configField{{"h", false}, {"a:b # C", true}, {"command", false}, {"1d", false}}},
+		{`h:a\:b\ c`, []configField{{"h", false}, {"a:b c", true}}},
+		{`h: x "y" z `, []configField{{"h", false}, {"x y z", true}}},
+		{`h:"":"[::1]"`, []configField{{"h", false}, {"", true}, {"[::1]", true}}},
+		{`h:ca="/a b"`, []configField{{"h", false}, {"ca=/a b", true}}},
+	}
+	for _, test := range tests {
+		if fs := splitFields(test.line); !reflect.DeepEqual(fs, test.fields) {
+			t.Errorf("%q: got %v, want %v", test.line, fs, test.fields)
+		}
+	}
+}
+
+func TestParseServerLineIPv6(t *testing.T) {
+	sc, err := ParseServerLine("[2001:db8::1]:443:tls:10d:addr=[2001:db8::2]:8443:sni=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Hostname != "2001:db8::1" || sc.Param != "443" || sc.Options.Addr != "[2001:db8::2]:8443" || sc.Options.SNI != "example.com" {
+		t.Errorf("got %+v", sc)
+	}
+	if addr := sc.Target().DialAddr(); addr != "[2001:db8::2]:8443" {
+		t.Errorf("got dial address %s", addr)
+	}
+	sc, err = ParseServerLine("example.com:443:tls:10d:addr=[2001:db8::2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := sc.Target().DialAddr(); addr != "[2001:db8::2]:443" {
+		t.Errorf("got dial address %s", addr)
+	}
+	sc, err = ParseServerLine("[::1]:443:tls:10d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Hostname != "::1" || sc.Param != "443" {
+		t.Errorf("got %+v", sc)
+	}
+	if addr := sc.Target().DialAddr(); addr != "[::1]:443" {
+		t.Errorf("got dial address %s", addr)
+	}
+	sc, err = ParseServerLine("localhost:443:tls:10d:addr=[::1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Options.Addr != "[::1]" {
+		t.Errorf("got addr %q", sc.Options.Addr)
+	}
+	if addr := sc.Target().DialAddr(); addr != "[::1]:443" {
+		t.Errorf("got dial address %s", addr)
+	}
+}
+
+func TestRemoveComment(t *testing.T) {
+	tests := []struct{ line, want string }{
+		{"example.com:443:tls:10d", "example.com:443:tls:10d"},
+		{"example.com:443:tls:10d # comment", "example.com:443:tls:10d "},
+		{"# comment", ""},
+		{`h:"a#b":command:1d#c`, `h:"a#b":command:1d`},
+		{`h:a\#b:command:1d#c`, `h:a\#b:command:1d`},
+		{`h:"a\"#b"#c`, `h:"a\"#b"`},
+	}
+	for _, test := range tests {
+		if r := removeComment(test.line); r != test.want {
+			t.Errorf("%q: got %q, want %q", test.line, r, test.want)
+		}
+	}
+}
+
+func TestParseSMTPLine(t *testing.T) {
+	tests := []struct {
+		line               string
+		username, password string
+	}{
+		{"mail.example.com:25:from:user:pass", "user", "pass"},
+		{" mail.example.com : 25 : from : user : pass ", "user", "pass"},
+		{`mail.example.com:25:from:user:pa\ss`, "user", `pa\ss`},
+		{`mail.example.com:25:from:us"er:pa"ss`, `us"er`, `pa"ss`},
+		{`mail.example.com:25:from:user:pass # comment`, "user", "pass"},
+		{`mail.example.com:25:from:"us:er":"pa#s\"s\\"`, "us:er", `pa#s"s\`},
+		{`mail.example.com:25:from:"user" :"pass" # comment`, "user", "pass"},
+		{`mail.example.com:25:from:"us"er:pass`, `"us"er`, "pass"},
+	}
+	for _, test := range tests {
+		sc, err := ParseSMTPLine(test.line)
+		if err != nil {
+			t.Errorf("%q: %s", test.line, err)
+			continue
+		}
+		if sc.Hostname != "mail.example.com" || sc.Port != "25" || sc.From != "from" ||
+			sc.Username != test.username || sc.Password != test.password {
+			t.Errorf("%q: got %+v", test.line, sc)
+		}
+	}
+	if _, err := ParseSMTPLine("mail.example.com:25:from:user:pa:ss"); err == nil {
+		t.Error("unquoted colon: no error")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config := `# certexpire checks
+=mail.example.com:25:from@example.com:user:pa\ss#word # comment
+@admin@example.com
+example.com:443:tls:10d # comment
+example.com:"/etc/ssl/A#1.pem":file:10d
+`
+	c, errs, err := ParseConfig(config)
+	if err != nil {
+		t.Fatalf("%s: %v", err, errs)
+	}
+	if c.Mail == nil || c.Mail.Password != `pa\ss` {
+		t.Errorf("got mail config %+v", c.Mail)
+	}
+	if len(c.Tests) != 1 || len(c.Tests[0].Checks) != 2 {
+		t.Fatalf("got %+v", c.Tests)
+	}
+	if p := c.Tests[0].Checks[1].Param; p != "/etc/ssl/A#1.pem" {
+		t.Errorf("got param %q", p)
+	}
+}
+
+func TestParseServerLineAllAddrs(t *testing.T) {
+	sc, err := ParseServerLine("example.com:443:tls:10d:addrs=all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Options.AllAddrs {
+		t.Errorf("addrs=all not set: %+v", sc.Options)
+	}
+	for _, l := range []string{
+		"example.com:/etc/ssl/cert.pem:file:10d:addrs=all",
+		"example.com:openssl x509:command:10d:addrs=all",
+		"example.com:/etc/ssl/certs:dir:10d:addrs=all",
+		"example.com:/etc/ssl/keystore.jks:jks:10d:addrs=all",
+		"example.com:/etc/letsencrypt:certbot:10d:addrs=all",
+		"example.com:secrets.yaml:k8s-secret:10d:addrs=all",
+	} {
+		if _, err := ParseServerLine(l); err == nil {
+			t.Errorf("%s: addrs=all accepted", l)
+		}
+	}
+}
+
+func TestParseSMTPLineBracket(t *testing.T) {
+	sc, err := ParseSMTPLine("mail.example.com:25:from:us[er:pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Username != "us[er" || sc.Password != "pass" {
+		t.Errorf("got %+v", sc)
+	}
+	sc, err = ParseSMTPLine("[2001:db8::25]:25:from:user:pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Hostname != "2001:db8::25" || sc.Port != "25" {
+		t.Errorf("got %+v", sc)
+	}
+}
+
+func TestTargetNames(t *testing.T) {
+	tests := []struct {
+		line                         string
+		dialAddr, serverName, verify string
+	}{
+		{"example.com:443:tls:10d", "example.com:443", "example.com", "example.com"},
+		{"example.com:443:tls:10d:sni=WWW.example.com", "example.com:443", "www.example.com", "www.example.com"},
+		{"example.com:443:tls:10d:sni=", "example.com:443", "", "example.com"},
+		{"example.com:443:tls:10d:addr=10.0.0.1", "10.0.0.1:443", "example.com", "example.com"},
+		{`example.com:443:tls:10d:addr="node1.example.com:8443"`, "node1.example.com:8443", "example.com", "example.com"},
+		{"example.com:443:tls:10d:addr=10.0.0.1:sni=", "10.0.0.1:443", "", "example.com"},
+	}
+	for _, test := range tests {
+		sc, err := ParseServerLine(test.line)
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+		tg := sc.Target()
+		if a := tg.DialAddr(); a != test.dialAddr {
+			t.Errorf("%s: got dial address %s, want %s", test.line, a, test.dialAddr)
+		}
+		if n := tg.serverName(); n != test.serverName {
+			t.Errorf("%s: got server name %q, want %q", test.line, n, test.serverName)
+		}
+		if n := tg.verifyName(); n != test.verify {
+			t.Errorf("%s: got verify name %q, want %q", test.line, n, test.verify)
+		}
+	}
+}
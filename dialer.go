@@ -3,20 +3,92 @@ package certexpire
 import (
 	"context"
 	"net"
+	"sync"
 	"time"
 
 	"golang.org/x/net/proxy"
 )
 
+// TCPDailer connects to hostaddr, optionally through a SOCKS5 proxy. The dial must complete within timeout.
 func TCPDailer(hostaddr string, proxyaddr *Proxy, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return TCPDailerContext(ctx, hostaddr, proxyaddr)
+}
+
+// TCPDailerContext connects to hostaddr, optionally through a SOCKS5 proxy. The dial is aborted when ctx is done.
+func TCPDailerContext(ctx context.Context, hostaddr string, proxyaddr *Proxy) (net.Conn, error) {
 	if proxyaddr == nil {
-		return net.DialTimeout("tcp", hostaddr, timeout)
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", hostaddr)
 	}
 	dial, err := proxy.SOCKS5("tcp", proxyaddr.Server, nil, nil)
 	if err != nil {
 		return nil, err
 	}
-	ctx, _ := context.WithTimeout(context.Background(), timeout)
 	d := dial.(proxy.ContextDialer)
 	return d.DialContext(ctx, "tcp", hostaddr)
 }
+
+// watchConn ties conn to ctx. The deadline of ctx becomes the deadline of conn, and pending reads and writes
+// are interrupted when ctx is done. The returned function stops watching.
+func watchConn(ctx context.Context, conn net.Conn) func() {
+	if d, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(d)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// contextError returns the error of ctx if it is done, err otherwise.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// fetchAllAddrs resolves the host of t and retrieves the certificate from each address concurrently.
+// Server name and verification stay those of t. The host is resolved locally, so this fails with ErrAddrsProxy
+// for targets behind a proxy, and with ErrConfig for protocols that do not connect to the host.
+func fetchAllAddrs(ctx context.Context, t *Target) []FetchResult {
+	if t.Proxy != nil {
+		return []FetchResult{{Err: ErrAddrsProxy}}
+	}
+	if localProtocols[cleanline(t.Protocol)] {
+		return []FetchResult{{Err: ErrConfig}}
+	}
+	host, port := t.Hostname, t.Param
+	if t.Options.Addr != "" {
+		host = unbracket(t.Options.Addr)
+		if h, p, err := net.SplitHostPort(t.Options.Addr); err == nil {
+			host, port = h, p
+		}
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return []FetchResult{{Err: contextError(ctx, err)}}
+	}
+	r := make([]FetchResult, len(ips))
+	wg := new(sync.WaitGroup)
+	for i, ip := range ips {
+		x := *t
+		x.Options.AllAddrs = false
+		x.Options.Addr = net.JoinHostPort(ip.String(), port)
+		r[i].Name = ip.String()
+		wg.Add(1)
+		go func(res *FetchResult) {
+			defer wg.Done()
+			res.Values, res.Err = FetchCert(ctx, &x)
+		}(&r[i])
+	}
+	wg.Wait()
+	return r
+}
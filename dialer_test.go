@@ -0,0 +1,46 @@
+package certexpire
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFetchAllAddrs(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	port := fakeServer(t, func(conn net.Conn) { serveTLS(conn, cert.TLS()) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := FetchCerts(ctx, &Target{
+		Hostname: "localhost",
+		Param:    port,
+		Protocol: "tls",
+		Options:  Options{Addr: "127.0.0.1", AllAddrs: true, Trust: TrustNone},
+	})
+	if len(r) != 1 {
+		t.Fatalf("got %d results, want 1", len(r))
+	}
+	if r[0].Name != "127.0.0.1" || r[0].Err != nil || r[0].Values == nil {
+		t.Fatalf("got result %+v", r[0])
+	}
+	if !r[0].Values.Expire.Equal(cert.Cert.NotAfter) {
+		t.Errorf("got expiry %s, want %s", r[0].Values.Expire, cert.Cert.NotAfter)
+	}
+
+	tests := []struct {
+		name   string
+		target Target
+		err    error
+	}{
+		{"proxy", Target{Hostname: "localhost", Param: "443", Proxy: &Proxy{Server: "127.0.0.1:1080"}}, ErrAddrsProxy},
+		{"file", Target{Hostname: "localhost", Param: "/etc/ssl/cert.pem", Protocol: "file"}, ErrConfig},
+	}
+	for _, test := range tests {
+		test.target.Options.AllAddrs = true
+		r := FetchCerts(ctx, &test.target)
+		if len(r) != 1 || r[0].Err != test.err {
+			t.Errorf("%s: got %+v, want error %v", test.name, r, test.err)
+		}
+	}
+}
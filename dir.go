@@ -0,0 +1,105 @@
+package certexpire
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// dirFiles returns the regular files matching the glob pattern. Matching directories are walked recursively.
+// Symbolic links to files are included, symbolic links to directories below a match are not followed.
+func dirFiles(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, &os.PathError{Op: "glob", Path: pattern, Err: os.ErrNotExist}
+	}
+	seen := make(map[string]bool)
+	files := make([]string, 0, len(matches))
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		root := m
+		if fi.IsDir() {
+			// The trailing separator makes Walk follow a symbolic link to the directory itself.
+			root = m + string(filepath.Separator)
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				if info, err = os.Stat(path); err != nil {
+					return nil
+				}
+			}
+			if !info.Mode().IsRegular() || seen[path] {
+				return nil
+			}
+			seen[path] = true
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// GetCertDir returns all certificates in the files below the directory or glob pattern, one result per certificate.
+func GetCertDir(ctx context.Context, servername, pattern string) []FetchResult {
+	return getCertDir(ctx, &Target{Hostname: servername, Param: pattern})
+}
+
+// getCertDir loads the certificates of all files matching t.Param. Each result carries the path of its file as
+// Param, and the position of the certificate as Name for files with several certificates. Files that do not
+// contain certificates, like private keys, are skipped. Files that fail to parse, e.g. because of a corrupt
+// certificate or a wrong password, are reported as errors. The certificates are only checked for expiry.
+func getCertDir(ctx context.Context, t *Target) []FetchResult {
+	files, err := dirFiles(t.Param)
+	if err != nil {
+		return []FetchResult{{Values: &CertValues{Hostname: t.Hostname}, Err: err}}
+	}
+	r := make([]FetchResult, 0, len(files))
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return append(r, FetchResult{Param: path, Err: err})
+		}
+		d, err := ioutil.ReadFile(path)
+		if err != nil {
+			r = append(r, FetchResult{Param: path, Values: &CertValues{Hostname: t.Hostname}, Err: err})
+			continue
+		}
+		certs, err := parseCerts(d, &t.Options)
+		if err == ErrNoCert {
+			continue
+		}
+		if err != nil {
+			r = append(r, FetchResult{Param: path, Values: &CertValues{Hostname: t.Hostname}, Err: err})
+			continue
+		}
+		for i, cert := range certs {
+			res := FetchResult{Param: path, Values: convertCertificate("", cert)}
+			res.Values.Hostname = t.Hostname
+			if len(certs) > 1 {
+				res.Name = strconv.Itoa(i + 1)
+			}
+			r = append(r, res)
+		}
+	}
+	if len(r) == 0 {
+		return []FetchResult{{Values: &CertValues{Hostname: t.Hostname}, Err: ErrNoCert}}
+	}
+	return r
+}
+
+func init() {
+	RegisterProtocol("dir", MultiFetcherFunc(getCertDir))
+}
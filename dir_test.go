@@ -0,0 +1,67 @@
+package certexpire
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestGetCertDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	leaf, inter, _ := testChain(t, "example.com")
+	p12, err := pkcs12.Encode(rand.Reader, leaf.Key, leaf.Cert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"fullchain.pem": append(leaf.PEM(), inter.PEM()...),
+		"sub/cert.pem":  leaf.PEM(),
+		"privkey.pem":   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}),
+		"README":        []byte("not a certificate\n"),
+		"corrupt.pem":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("corrupt")}),
+		"server.p12":    p12,
+	}
+	for name, d := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, d, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := GetCertDir(context.Background(), "example.com", dir)
+	sort.Slice(r, func(i, j int) bool { return r[i].Param+r[i].Name < r[j].Param+r[j].Name })
+	want := []struct {
+		file, name string
+		err        bool
+	}{
+		{"corrupt.pem", "", true},
+		{"fullchain.pem", "1", false},
+		{"fullchain.pem", "2", false},
+		{"server.p12", "", true},
+		{"sub/cert.pem", "", false},
+	}
+	if len(r) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(r), len(want), r)
+	}
+	for i, w := range want {
+		if r[i].Param != filepath.Join(dir, w.file) || r[i].Name != w.name || (r[i].Err != nil) != w.err {
+			t.Errorf("result %d: got %s@%s %v, want %s@%s", i, r[i].Param, r[i].Name, r[i].Err, w.file, w.name)
+		}
+	}
+	if r := GetCertDir(context.Background(), "example.com", filepath.Join(dir, "*.key")); len(r) != 1 || r[0].Err == nil {
+		t.Errorf("no match: got %+v", r)
+	}
+}
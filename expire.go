@@ -1,6 +1,7 @@
 package certexpire
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha512"
 	"crypto/tls"
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"os"
 	"os/exec"
 	"time"
 )
@@ -16,10 +18,6 @@ import (
 // // TLSTimeout is timeout for negotiating a TLS connection.
 // var TLSTimeout = time.Second * 10
 
-func deadline(timeout time.Duration) time.Time {
-	return time.Now().Add(timeout)
-}
-
 // CertValues contains the relevant aspects of a certificate.
 type CertValues struct {
 	Hostname    string    // Hostname used for retrieval connection.
@@ -27,6 +25,25 @@ type CertValues struct {
 	VerifyError error     // Any TLS  errors when connecting.
 	Hash        string    // Hash of the raw certificate.
 	Certificate *x509.Certificate
+	Chain       []*x509.Certificate // All certificates checked for expiry, e.g. of a bundle file or the served and verified chain, in order. Empty if only Certificate.
+	OCSPStatus  string              // Revocation status from OCSP, one of the OCSP status constants. Empty if not checked.
+	OCSPErrors  []error             // Problems found by the OCSP check, like ErrRevoked.
+}
+
+// ExpireError reports a certificate of a chain or bundle that expires within the deadline.
+type ExpireError struct {
+	Position int    // Position of the certificate in the chain or file, starting at 1.
+	Subject  string // Subject of the certificate.
+	Expire   time.Time
+}
+
+func (e *ExpireError) Error() string {
+	return fmt.Sprintf("%s: certificate %d (%s) expires %s", ErrExpire, e.Position, e.Subject, e.Expire.Format("2006-01-02"))
+}
+
+// Unwrap returns ErrExpire.
+func (e *ExpireError) Unwrap() error {
+	return ErrExpire
 }
 
 func hashString(d []byte) string {
@@ -51,11 +68,29 @@ func convertCertificate(hostname string, cert *x509.Certificate, prevError ...er
 
 // GetCertificate returns the server certificate's expiry time. conn is an established connection. hostname is the hostname of the remote server.
 func GetCertificate(conn net.Conn, hostname string, timeout time.Duration) (*CertValues, error) {
-	c := tls.Client(conn, &tls.Config{ServerName: hostname, InsecureSkipVerify: true})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertificateContext(ctx, conn, hostname)
+}
+
+// GetCertificateContext is like GetCertificate, but the handshake is aborted when ctx is done.
+func GetCertificateContext(ctx context.Context, conn net.Conn, hostname string) (*CertValues, error) {
+	return GetCertificateTarget(ctx, conn, &Target{Hostname: hostname})
+}
+
+// GetCertificateTarget runs the TLS handshake on conn and verifies the certificate according to t, including the
+// sni, ca, trust and ocsp options. Fetchers of other packages use it on a connection to t.DialAddr().
+func GetCertificateTarget(ctx context.Context, conn net.Conn, t *Target) (*CertValues, error) {
+	hostname := t.verifyName()
+	c := tls.Client(conn, &tls.Config{ServerName: t.serverName(), InsecureSkipVerify: true})
 	defer c.Close()
-	_ = c.SetDeadline(deadline(timeout))
+	stop := watchConn(ctx, c)
+	defer stop()
 	err := c.Handshake()
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return &CertValues{
 			Hostname:    hostname,
 			VerifyError: err,
@@ -69,89 +104,236 @@ func GetCertificate(conn net.Conn, hostname string, timeout time.Duration) (*Cer
 			Hostname: hostname,
 		}, ErrNoCert
 	}
-	roots, err := x509.SystemCertPool()
+	roots, err := t.Options.rootPool()
 	if err != nil {
 		return nil, err
 	}
-	opts := x509.VerifyOptions{
-		Roots:         roots,
-		CurrentTime:   time.Now(),
-		Intermediates: x509.NewCertPool(),
+	ret := convertCertificate(hostname, certs[0])
+	var chains [][]*x509.Certificate
+	if roots != nil {
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			CurrentTime:   time.Now(),
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		chains, err = certs[0].Verify(opts)
+		if err != nil && ret.VerifyError == nil {
+			ret.VerifyError = err
+		}
 	}
-	for _, cert := range certs[1:] {
-		opts.Intermediates.AddCert(cert)
+	if chain := fullChain(certs, chains); len(chain) > 1 {
+		ret.Chain = chain
 	}
-	if _, err := certs[0].Verify(opts); err != nil {
-		return convertCertificate(hostname, certs[0], err), nil
+	if t.Options.OCSP != OCSPOff {
+		checkOCSP(ctx, t, ret, state.OCSPResponse, certs[0], ocspIssuer(certs, chains))
 	}
-	return convertCertificate(hostname, certs[0]), nil
+	return ret, nil
 }
 
-func verifyPEM(servername string, d []byte) (*CertValues, error) {
-	block, _ := pem.Decode(d)
-	if block == nil || block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
-		return &CertValues{
-			Hostname: servername,
-		}, ErrNoCert
+// fullChain returns the certificates served, followed by those of the first verified chain that were not served,
+// like the root.
+func fullChain(served []*x509.Certificate, chains [][]*x509.Certificate) []*x509.Certificate {
+	chain := append([]*x509.Certificate{}, served...)
+	if len(chains) == 0 {
+		return chain
 	}
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return &CertValues{
-			Hostname: servername,
-		}, ErrNoCert
+	for _, c := range chains[0] {
+		found := false
+		for _, s := range served {
+			if c.Equal(s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			chain = append(chain, c)
+		}
+	}
+	return chain
+}
+
+// parsePEM returns all certificates of the PEM encoded data d, in order. Other blocks, like keys, are skipped.
+func parsePEM(d []byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, 1)
+	for {
+		var block *pem.Block
+		block, d = pem.Decode(d)
+		if block == nil {
+			break
+		}
+		if block.Type == "PKCS7" {
+			c, err := parsePKCS7(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, c...)
+			continue
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("certexpire: certificate %d: %s", len(certs)+1, err)
+		}
+		certs = append(certs, cert)
 	}
-	return convertCertificate(servername, cert), nil
+	if len(certs) == 0 {
+		return nil, ErrNoCert
+	}
+	return certs, nil
+}
+
+// verifyCerts converts the certificates of a file. The first certificate is the leaf, unless leafByName is set
+// and another certificate is valid for servername.
+func verifyCerts(servername string, certs []*x509.Certificate, leafByName bool) *CertValues {
+	leaf := certs[0]
+	if leafByName && servername != "" {
+		for _, c := range certs {
+			if c.VerifyHostname(servername) == nil {
+				leaf = c
+				break
+			}
+		}
+	}
+	ret := convertCertificate(servername, leaf)
+	if len(certs) > 1 {
+		ret.Chain = certs
+	}
+	return ret
 }
 
-// GetCertFile verifies a file
+// GetCertFile verifies a file. All certificates in the file are checked, the first is the leaf.
 func GetCertFile(servername, path string) (*CertValues, error) {
-	d, err := ioutil.ReadFile(path)
+	return getCertFile(&Target{Hostname: servername, Param: path})
+}
+
+func getCertFile(t *Target) (*CertValues, error) {
+	d, err := ioutil.ReadFile(t.Param)
 	if err != nil {
 		return &CertValues{
-			Hostname: servername,
+			Hostname: t.Hostname,
 		}, err
 	}
-	return verifyPEM(servername, d)
+	return loadCerts(t, d)
 }
 
 // GetCertCMD runs a command and interpretes the standard output as a certificate.
+// The command is split into arguments at whitespace. Quotes and backslashes work like in the shell.
 func GetCertCMD(servername, command string, timeout time.Duration) (*CertValues, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	d, err := exec.CommandContext(ctx, command).Output()
+	return GetCertCMDContext(ctx, servername, command)
+}
+
+// GetCertCMDContext is like GetCertCMD, but the command is killed when ctx is done.
+func GetCertCMDContext(ctx context.Context, servername, command string) (*CertValues, error) {
+	return getCertCMD(ctx, &Target{Hostname: servername, Param: command})
+}
+
+// runCommand runs t.Param as command, or with sh -c if t.Options.Shell is set, and returns its standard output.
+// t.Options.Env is added to the environment.
+func runCommand(ctx context.Context, t *Target) ([]byte, error) {
+	var cmd *exec.Cmd
+	if t.Options.Shell {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", t.Param)
+	} else {
+		args, err := splitArgs(t.Param)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, ErrConfig
+		}
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	}
+	if len(t.Options.Env) > 0 {
+		cmd.Env = append(os.Environ(), t.Options.Env...)
+	}
+	d, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			err = fmt.Errorf("%s: %s", err, bytes.TrimSpace(ee.Stderr))
+		}
+		return nil, contextError(ctx, err)
+	}
+	return d, nil
+}
+
+// getCertCMD runs the command t.Param and loads the certificates of its output.
+func getCertCMD(ctx context.Context, t *Target) (*CertValues, error) {
+	d, err := runCommand(ctx, t)
 	if err != nil {
 		return &CertValues{
-			Hostname: servername,
+			Hostname: t.Hostname,
 		}, err
 	}
-	return verifyPEM(servername, d)
+	return loadCerts(t, d)
 }
 
 // GetCertTLS returns the server certificate's expiry time for a TLS server.
 func GetCertTLS(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
-	conn, err := TCPDailer(servername+":"+port, proxy, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertTLSContext(ctx, servername, port, proxy)
+}
+
+// GetCertTLSContext is like GetCertTLS, but dialing and handshake are aborted when ctx is done.
+func GetCertTLSContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), nil)
+}
+
+// getCertPrelude connects to t, runs prelude on the connection to negotiate TLS and then retrieves the certificate.
+// A nil prelude starts the handshake right away.
+func getCertPrelude(ctx context.Context, t *Target, prelude func(conn net.Conn) error) (*CertValues, error) {
+	conn, err := TCPDailerContext(ctx, t.DialAddr(), t.Proxy)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
-	conn.SetDeadline(deadline(timeout))
-	return GetCertificate(conn, servername, timeout)
+	if prelude != nil {
+		stop := watchConn(ctx, conn)
+		defer stop()
+		if err := prelude(conn); err != nil {
+			return nil, contextError(ctx, err)
+		}
+	}
+	return GetCertificateTarget(ctx, conn, t)
+}
+
+// preludeFetcher returns a Fetcher that negotiates TLS with prelude before the handshake.
+func preludeFetcher(prelude func(conn net.Conn) error) Fetcher {
+	return FetcherFunc(func(ctx context.Context, t *Target) (*CertValues, error) {
+		return getCertPrelude(ctx, t, prelude)
+	})
 }
 
-// GetCert returns the server certificate's expiry time. Proto is tls/ssl, imap, smtp.
+// GetCert returns the server certificate's expiry time. Proto is the name of a registered protocol, e.g. tls/ssl, imap, smtp.
 func GetCert(servername, param, proto string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
-	switch proto {
-	case "tls", "ssl", "":
-		return GetCertTLS(servername, param, timeout, proxy)
-	case "imap":
-		return GetCertIMAP(servername, param, timeout, proxy)
-	case "smtp":
-		return GetCertSMTP(servername, param, timeout, proxy)
-	case "file":
-		return GetCertFile(servername, param)
-	case "command":
-		return GetCertCMD(servername, param, timeout)
-	default:
-		return nil, ErrConfig
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertContext(ctx, servername, param, proto, proxy)
+}
+
+// GetCertContext is like GetCert, but the retrieval is aborted when ctx is done.
+func GetCertContext(ctx context.Context, servername, param, proto string, proxy *Proxy) (*CertValues, error) {
+	return FetchCert(ctx, &Target{
+		Hostname: servername,
+		Param:    param,
+		Protocol: proto,
+		Proxy:    proxy,
+	})
+}
+
+func init() {
+	tlsFetcher := preludeFetcher(nil)
+	RegisterProtocol("tls", tlsFetcher)
+	RegisterProtocol("ssl", tlsFetcher)
+	RegisterProtocol("file", FetcherFunc(func(ctx context.Context, t *Target) (*CertValues, error) {
+		return getCertFile(t)
+	}))
+	RegisterProtocol("command", FetcherFunc(getCertCMD))
 }
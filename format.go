@@ -0,0 +1,225 @@
+package certexpire
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Formats of certificate files and command output.
+const (
+	FormatAuto   = "" // Detect the format.
+	FormatPEM    = "pem"
+	FormatDER    = "der"
+	FormatPKCS7  = "pkcs7"
+	FormatPKCS12 = "pkcs12"
+)
+
+var formatNames = map[string]string{
+	"auto":   FormatAuto,
+	"pem":    FormatPEM,
+	"der":    FormatDER,
+	"pkcs7":  FormatPKCS7,
+	"p7b":    FormatPKCS7,
+	"pkcs12": FormatPKCS12,
+	"p12":    FormatPKCS12,
+	"pfx":    FormatPKCS12,
+}
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// parsePKCS7 returns the certificates of a DER encoded PKCS#7 SignedData structure, like .p7b files.
+func parsePKCS7(d []byte) ([]*x509.Certificate, error) {
+	ci := new(pkcs7ContentInfo)
+	if _, err := asn1.Unmarshal(d, ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("certexpire: pkcs7: not signed data")
+	}
+	sd := new(pkcs7SignedData)
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, sd); err != nil {
+		return nil, err
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCert
+	}
+	return sortChain(certs), nil
+}
+
+// sortChain orders certs from the leaf to the root. PKCS#7 stores certificates as a set, without order.
+func sortChain(certs []*x509.Certificate) []*x509.Certificate {
+	issuer := func(c, i *x509.Certificate) bool {
+		return c != i && bytes.Equal(c.RawIssuer, i.RawSubject)
+	}
+	var leaf *x509.Certificate
+	for _, c := range certs {
+		isIssuer := false
+		for _, o := range certs {
+			if issuer(o, c) {
+				isIssuer = true
+				break
+			}
+		}
+		if !isIssuer {
+			leaf = c
+			break
+		}
+	}
+	if leaf == nil {
+		return certs
+	}
+	sorted := []*x509.Certificate{leaf}
+	used := map[*x509.Certificate]bool{leaf: true}
+	for c := leaf; c != nil; {
+		next := c
+		c = nil
+		for _, o := range certs {
+			if !used[o] && issuer(next, o) {
+				c = o
+				used[o] = true
+				sorted = append(sorted, o)
+				break
+			}
+		}
+	}
+	for _, c := range certs {
+		if !used[c] {
+			sorted = append(sorted, c)
+		}
+	}
+	return sorted
+}
+
+// parsePKCS12 returns the certificates of a PKCS#12 file. The certificate of the private key comes first.
+func parsePKCS12(d []byte, password string) ([]*x509.Certificate, error) {
+	_, cert, caCerts, err := pkcs12.DecodeChain(d, password)
+	if err == nil {
+		return append([]*x509.Certificate{cert}, caCerts...), nil
+	}
+	if err == pkcs12.ErrIncorrectPassword {
+		return nil, err
+	}
+	// Files with several keys.
+	if blocks, err := pkcs12.ToPEM(d, password); err == nil {
+		var certs []*x509.Certificate
+		for _, block := range blocks {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) > 0 {
+			return certs, nil
+		}
+	}
+	// Java trust stores, which have no private key.
+	if certs, err := pkcs12.DecodeTrustStore(d, password); err == nil && len(certs) > 0 {
+		return certs, nil
+	}
+	return nil, err
+}
+
+// password returns the password of the certificate file, read from the environment or a file.
+func (o *Options) password() (string, error) {
+	switch {
+	case o.PasswordEnv != "":
+		p, ok := os.LookupEnv(o.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("certexpire: password variable %s not set", o.PasswordEnv)
+		}
+		return p, nil
+	case o.PasswordFile != "":
+		p, err := ioutil.ReadFile(o.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(p), "\r\n"), nil
+	default:
+		return "", nil
+	}
+}
+
+// parseCerts returns the certificates contained in d, which is in the format of o.Format.
+func parseCerts(d []byte, o *Options) ([]*x509.Certificate, error) {
+	switch o.Format {
+	case FormatPEM:
+		return parsePEM(d)
+	case FormatDER:
+		return x509.ParseCertificates(d)
+	case FormatPKCS7:
+		return parsePKCS7(d)
+	case FormatPKCS12:
+		password, err := o.password()
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS12(d, password)
+	}
+	if bytes.Contains(d, []byte("-----BEGIN ")) {
+		return parsePEM(d)
+	}
+	if certs, err := x509.ParseCertificates(d); err == nil && len(certs) > 0 {
+		return certs, nil
+	}
+	if certs, err := parsePKCS7(d); err == nil {
+		return certs, nil
+	}
+	password, err := o.password()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parsePKCS12(d, password)
+	if err == pkcs12.ErrIncorrectPassword {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrNoCert
+	}
+	return certs, nil
+}
+
+// loadCerts converts the certificates of file or command output d.
+func loadCerts(t *Target, d []byte) (*CertValues, error) {
+	certs, err := parseCerts(d, &t.Options)
+	if err != nil {
+		return &CertValues{
+			Hostname: t.Hostname,
+		}, err
+	}
+	if len(certs) == 0 {
+		return &CertValues{
+			Hostname: t.Hostname,
+		}, ErrNoCert
+	}
+	return verifyCerts(t.Hostname, certs, t.Options.LeafByName), nil
+}
@@ -0,0 +1,65 @@
+package certexpire
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+)
+
+func ftpHasAuthTLS(s []string) bool {
+	for _, l := range s {
+		f := strings.FieldsFunc(strings.ToUpper(l), func(r rune) bool { return r == ';' || unicode.IsSpace(r) })
+		if len(f) > 1 && f[0] == "AUTH" {
+			for _, m := range f[1:] {
+				if m == "TLS" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ftpFeatures fails with ErrNoTLS if the FEAT reply lacks AUTH TLS. Servers that do not know FEAT may still support it.
+func ftpFeatures(rep *textReply) error {
+	if rep.code == "211" && !ftpHasAuthTLS(rep.lines) {
+		return ErrNoTLS
+	}
+	return nil
+}
+
+func ftpAuthTLS(rep *textReply) error {
+	if rep.code != "234" {
+		return fmt.Errorf("certexpire: ftp AUTH TLS refused: %s %s", rep.code, strings.TrimSpace(strings.Join(rep.lines, " ")))
+	}
+	return nil
+}
+
+var ftpScript = []textStep{
+	{read: readNumeric, expect: []textCheck{expectCode("220")}},
+	{send: "FEAT\r\n", read: readNumeric, expect: []textCheck{ftpFeatures}},
+	{send: "AUTH TLS\r\n", read: readNumeric, expect: []textCheck{ftpAuthTLS}},
+}
+
+func ftpprelude(conn net.Conn) error {
+	return runTextScript(conn, ftpScript)
+}
+
+// GetCertFTP returns the expiration date of an FTP AUTH TLS cert.
+func GetCertFTP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertFTPContext(ctx, servername, port, proxy)
+}
+
+// GetCertFTPContext is like GetCertFTP, but the retrieval is aborted when ctx is done.
+func GetCertFTPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), ftpprelude)
+}
+
+func init() {
+	RegisterProtocol("ftp", preludeFetcher(ftpprelude))
+}
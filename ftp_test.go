@@ -0,0 +1,64 @@
+package certexpire
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFTP(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	feat := "211-Features:\r\n AUTH TLS;AUTH SSL\r\n PBSZ\r\n PROT\r\n211 End\r\n"
+
+	tests := []struct {
+		name string
+		feat string
+	}{
+		{"feat", feat},
+		// Servers that do not know FEAT may still support AUTH TLS.
+		{"no-feat", "500 Unknown command\r\n"},
+	}
+	for _, test := range tests {
+		port := textServerTLS(t, cert, "220 FTP ready\r\n", test.feat, "234 AUTH TLS ok\r\n")
+		cv, err := GetCertFTPContext(ctx, "localhost", port, nil)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if cv.Certificate == nil || !cv.Certificate.Equal(cert.Cert) {
+			t.Errorf("%s: wrong certificate", test.name)
+		}
+	}
+
+	noTLS := textServer(t, "220 FTP ready\r\n", "211-Features:\r\n MDTM\r\n SIZE\r\n211 End\r\n")
+	if _, err := GetCertFTPContext(ctx, "localhost", noTLS, nil); !errors.Is(err, ErrNoTLS) {
+		t.Errorf("no AUTH TLS: got error %v, want %v", err, ErrNoTLS)
+	}
+	refused := textServer(t, "220 FTP ready\r\n", feat, "534 Policy requires SSL\r\n")
+	_, err := GetCertFTPContext(ctx, "localhost", refused, nil)
+	if err == nil || !strings.Contains(err.Error(), "534") {
+		t.Errorf("refused: got error %v", err)
+	}
+}
+
+func TestFTPHasAuthTLS(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  bool
+	}{
+		{[]string{"Features:", " AUTH TLS", "End"}, true},
+		{[]string{" auth ssl;tls"}, true},
+		{[]string{" AUTH SSL"}, false},
+		{[]string{" TLS"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := ftpHasAuthTLS(test.lines); got != test.want {
+			t.Errorf("%q: got %v", test.lines, got)
+		}
+	}
+}
@@ -4,5 +4,8 @@ go 1.13
 
 require (
 	github.com/gammazero/workerpool v0.0.0-20200108033143-79b2336fad7a
-	golang.org/x/net v0.0.0-20200114155413-6afb5195e5aa
+	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
+	gopkg.in/yaml.v2 v2.4.0
+	software.sslmate.com/src/go-pkcs12 v0.2.0
 )
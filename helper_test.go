@@ -0,0 +1,109 @@
+package certexpire
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate for tests, with its key.
+type testCert struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate for host that expires at notAfter. It is signed by issuer, or self-signed
+// as CA if issuer is nil. opts modify the certificate before it is signed.
+func newTestCert(t *testing.T, host string, notAfter time.Time, issuer *testCert, opts ...func(c *x509.Certificate)) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	parent, signer := tmpl, key
+	if issuer == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		parent, signer = issuer.Cert, issuer.Key
+	}
+	for _, o := range opts {
+		o(tmpl)
+	}
+	d, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{Cert: cert, Key: key}
+}
+
+// asCA makes the certificate a CA, e.g. an intermediate.
+func asCA(c *x509.Certificate) {
+	c.IsCA = true
+	c.BasicConstraintsValid = true
+}
+
+// PEM returns the certificate PEM encoded.
+func (c *testCert) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// TLS returns the certificate for use by tls.Server, with the certificates of chain.
+func (c *testCert) TLS(chain ...*testCert) tls.Certificate {
+	r := tls.Certificate{Certificate: [][]byte{c.Cert.Raw}, PrivateKey: c.Key, Leaf: c.Cert}
+	for _, x := range chain {
+		r.Certificate = append(r.Certificate, x.Cert.Raw)
+	}
+	return r
+}
+
+// fakeServer accepts one connection on a local port and runs serve on it. It returns the port.
+func fakeServer(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		_ = l.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		serve(conn)
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// serveTLS runs the server side of the TLS handshake on conn with cert.
+func serveTLS(conn net.Conn, cert tls.Certificate) {
+	_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+}
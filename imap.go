@@ -2,6 +2,7 @@ package certexpire
 
 import (
 	"bytes"
+	"context"
 	"net"
 	"time"
 )
@@ -25,42 +26,27 @@ func imapHasStartTLS(m []byte) bool {
 	return false
 }
 
+var imapScript = []textStep{
+	{read: readLine, expect: []textCheck{expectPrefix("* OK"), expectCapabilityErr(func(l []string) bool { return imapHasStartTLS([]byte(l[0])) }, ErrProtocol)}},
+	{send: "001 STARTTLS\r\n", read: readLine, expect: []textCheck{expectContains("001 OK")}},
+}
+
 func imapprelude(conn net.Conn) error {
-	r := NewLineReader(conn)
-	l, err := r.Line()
-	if err != nil {
-		return err
-	}
-	if !bytes.Equal(l[0:4], []byte("* OK")) {
-		return ErrProtocol
-	}
-	if !imapHasStartTLS(l[4:]) {
-		return ErrProtocol
-	}
-	_, err = conn.Write([]byte("001 STARTTLS\r\n"))
-	if err != nil {
-		return err
-	}
-	l, err = r.Line()
-	if err != nil {
-		return err
-	}
-	if bytes.Index(l, []byte("001 OK")) < 0 {
-		return ErrProtocol
-	}
-	return nil
+	return runTextScript(conn, imapScript)
 }
 
 // GetCertIMAP returns the expiration date of an IMAP STARTTLS cert.
 func GetCertIMAP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
-	conn, err := TCPDailer(servername+":"+port, proxy, timeout)
-	if err != nil {
-		return nil, err
-	}
-	conn.SetDeadline(deadline(timeout))
-	defer conn.Close()
-	if err := imapprelude(conn); err != nil {
-		return nil, err
-	}
-	return GetCertificate(conn, servername, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertIMAPContext(ctx, servername, port, proxy)
+}
+
+// GetCertIMAPContext is like GetCertIMAP, but the retrieval is aborted when ctx is done.
+func GetCertIMAPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), imapprelude)
+}
+
+func init() {
+	RegisterProtocol("imap", preludeFetcher(imapprelude))
 }
@@ -0,0 +1,206 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"unicode/utf16"
+)
+
+var (
+	ErrKeyStore          = errors.New("certexpire: keystore: malformed or unsupported")
+	ErrKeyStoreIntegrity = errors.New("certexpire: keystore: integrity check failed, wrong password?")
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+
+	jksPrivateKey  = 1
+	jksTrustedCert = 2
+	jksSecretKey   = 3
+)
+
+// jksEntry is an entry of a Java keystore that contains certificates.
+type jksEntry struct {
+	alias   string
+	trusted bool // Trusted certificate entry, otherwise private key with certificate chain.
+	chain   []*x509.Certificate
+	err     error // The entry could not be read, like a secret key entry.
+}
+
+// jksReader reads the fields of a Java keystore. After the first error, all reads return zero values.
+type jksReader struct {
+	d       []byte
+	pos     int
+	version uint32
+	err     error
+}
+
+func (r *jksReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.d)-r.pos < n {
+		r.err = ErrKeyStore
+		return nil
+	}
+	b := r.d[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *jksReader) uint16() int {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (r *jksReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// utf reads a string in Java's modified UTF-8, which is plain UTF-8 for all but unusual aliases.
+func (r *jksReader) utf() string {
+	return string(r.next(r.uint16()))
+}
+
+// cert reads one certificate, which is preceded by its type in version 2 keystores.
+func (r *jksReader) cert() *x509.Certificate {
+	if r.version == 2 {
+		if t := r.utf(); r.err == nil && t != "X.509" {
+			r.err = fmt.Errorf("certexpire: keystore: unsupported certificate type %q", t)
+		}
+	}
+	d := r.next(int(r.uint32()))
+	if r.err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(d)
+	if err != nil {
+		r.err = err
+	}
+	return cert
+}
+
+// jksDigest returns the integrity digest of keystore data d for password.
+func jksDigest(d []byte, password string) []byte {
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(d)
+	return h.Sum(nil)
+}
+
+// parseJKS returns the entries of the JKS or JCEKS keystore d. The integrity of the keystore is verified
+// with password if verify is set. A secret key entry ends the keystore, it is returned with an error.
+func parseJKS(d []byte, password string, verify bool) ([]jksEntry, error) {
+	r := &jksReader{d: d}
+	if magic := r.uint32(); magic != jksMagic && magic != jceksMagic {
+		return nil, ErrKeyStore
+	}
+	r.version = r.uint32()
+	if r.version != 1 && r.version != 2 {
+		return nil, ErrKeyStore
+	}
+	count := r.uint32()
+	entries := make([]jksEntry, 0, 1)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		e := jksEntry{alias: r.utf()}
+		r.next(8) // Creation date.
+		switch tag {
+		case jksPrivateKey:
+			r.next(int(r.uint32())) // Protected private key.
+			n := r.uint32()
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				e.chain = append(e.chain, r.cert())
+			}
+		case jksTrustedCert:
+			e.trusted = true
+			e.chain = append(e.chain, r.cert())
+		case jksSecretKey:
+			// Secret keys are serialized Java objects, whose length is unknown. Reading stops here, the entries
+			// read so far are returned.
+			e.err = fmt.Errorf("certexpire: keystore: secret key entry %q not supported, later entries and the integrity are not checked", e.alias)
+			return append(entries, e), nil
+		default:
+			return nil, ErrKeyStore
+		}
+		if r.err == nil && len(e.chain) > 0 {
+			entries = append(entries, e)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	digest := r.next(sha1.Size)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if verify && !bytes.Equal(digest, jksDigest(d[:r.pos-sha1.Size], password)) {
+		return nil, ErrKeyStoreIntegrity
+	}
+	return entries, nil
+}
+
+// GetCertJKS returns the certificates of the Java keystore (JKS or JCEKS) at path, one result per alias.
+func GetCertJKS(servername, path string) []FetchResult {
+	return getCertJKS(&Target{Hostname: servername, Param: path})
+}
+
+// getCertJKS loads the keystore t.Param. If a password is configured, the integrity of the keystore is verified.
+// The certificate chain of private key entries is verified for t.Hostname, trusted certificates are only checked
+// for expiry.
+func getCertJKS(t *Target) []FetchResult {
+	fail := func(err error) []FetchResult {
+		return []FetchResult{{Values: &CertValues{Hostname: t.Hostname}, Err: err}}
+	}
+	d, err := ioutil.ReadFile(t.Param)
+	if err != nil {
+		return fail(err)
+	}
+	password, err := t.Options.password()
+	if err != nil {
+		return fail(err)
+	}
+	verify := t.Options.PasswordEnv != "" || t.Options.PasswordFile != ""
+	entries, err := parseJKS(d, password, verify)
+	if err != nil {
+		return fail(err)
+	}
+	if len(entries) == 0 {
+		return fail(ErrNoCert)
+	}
+	r := make([]FetchResult, 0, len(entries))
+	for _, e := range entries {
+		if e.err != nil {
+			r = append(r, FetchResult{Name: e.alias, Values: &CertValues{Hostname: t.Hostname}, Err: e.err})
+			continue
+		}
+		hostname := t.Hostname
+		if e.trusted {
+			hostname = ""
+		}
+		cv := verifyCerts(hostname, e.chain, t.Options.LeafByName)
+		cv.Hostname = t.Hostname
+		r = append(r, FetchResult{Name: e.alias, Values: cv})
+	}
+	return r
+}
+
+func init() {
+	RegisterProtocol("jks", MultiFetcherFunc(func(ctx context.Context, t *Target) []FetchResult {
+		return getCertJKS(t)
+	}))
+}
@@ -0,0 +1,184 @@
+package certexpire
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// jksBuilder writes Java keystores for tests.
+type jksBuilder struct {
+	bytes.Buffer
+	version uint32
+}
+
+func (b *jksBuilder) u32(v uint32) {
+	_ = binary.Write(b, binary.BigEndian, v)
+}
+
+func (b *jksBuilder) utf(s string) {
+	_ = binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+func (b *jksBuilder) cert(c *testCert) {
+	if b.version == 2 {
+		b.utf("X.509")
+	}
+	b.u32(uint32(len(c.Cert.Raw)))
+	b.Write(c.Cert.Raw)
+}
+
+// header writes the magic, version and number of entries.
+func (b *jksBuilder) header(magic uint32, count int) {
+	b.u32(magic)
+	b.u32(b.version)
+	b.u32(uint32(count))
+}
+
+func (b *jksBuilder) trusted(alias string, c *testCert) {
+	b.u32(jksTrustedCert)
+	b.utf(alias)
+	b.Write(make([]byte, 8))
+	b.cert(c)
+}
+
+func (b *jksBuilder) privateKey(alias string, chain ...*testCert) {
+	b.u32(jksPrivateKey)
+	b.utf(alias)
+	b.Write(make([]byte, 8))
+	b.u32(4)
+	b.WriteString("key!")
+	b.u32(uint32(len(chain)))
+	for _, c := range chain {
+		b.cert(c)
+	}
+}
+
+// finish appends the integrity digest for password and returns the keystore.
+func (b *jksBuilder) finish(password string) []byte {
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(b.Bytes())
+	b.Write(h.Sum(nil))
+	return b.Bytes()
+}
+
+func testKeyStore(t *testing.T, magic, version uint32) ([]byte, *testCert, *testCert, *testCert) {
+	leaf, inter, root := testChain(t, "example.com")
+	b := &jksBuilder{version: version}
+	b.header(magic, 2)
+	b.privateKey("server", leaf, inter)
+	b.trusted("root", root)
+	return b.finish("changeit"), leaf, inter, root
+}
+
+func TestParseJKS(t *testing.T) {
+	for _, f := range []struct {
+		name           string
+		magic, version uint32
+	}{{"jks-v2", jksMagic, 2}, {"jks-v1", jksMagic, 1}, {"jceks", jceksMagic, 2}} {
+		ks, leaf, inter, root := testKeyStore(t, f.magic, f.version)
+		entries, err := parseJKS(ks, "changeit", true)
+		if err != nil {
+			t.Errorf("%s: %s", f.name, err)
+			continue
+		}
+		if len(entries) != 2 {
+			t.Errorf("%s: got %d entries", f.name, len(entries))
+			continue
+		}
+		if e := entries[0]; e.alias != "server" || e.trusted || !sameCerts(e.chain, leaf, inter) {
+			t.Errorf("%s: wrong private key entry %+v", f.name, e)
+		}
+		if e := entries[1]; e.alias != "root" || !e.trusted || !sameCerts(e.chain, root) {
+			t.Errorf("%s: wrong trusted entry %+v", f.name, e)
+		}
+	}
+
+	ks, _, _, _ := testKeyStore(t, jksMagic, 2)
+	if _, err := parseJKS(ks, "wrong", true); err != ErrKeyStoreIntegrity {
+		t.Errorf("wrong password: got error %v, want %v", err, ErrKeyStoreIntegrity)
+	}
+	if _, err := parseJKS(ks, "wrong", false); err != nil {
+		t.Errorf("wrong password, not verified: %s", err)
+	}
+	if _, err := parseJKS(ks[:len(ks)-30], "", false); err != ErrKeyStore {
+		t.Errorf("truncated: got error %v, want %v", err, ErrKeyStore)
+	}
+	bad := append([]byte{0xca, 0xfe, 0xba, 0xbe}, ks[4:]...)
+	if _, err := parseJKS(bad, "", false); err != ErrKeyStore {
+		t.Errorf("bad magic: got error %v, want %v", err, ErrKeyStore)
+	}
+	_, _, root := testChain(t, "example.com")
+	b := &jksBuilder{version: 2}
+	b.header(jceksMagic, 3)
+	b.trusted("root", root)
+	b.u32(jksSecretKey)
+	b.utf("aes")
+	b.Write(make([]byte, 8))
+	b.WriteString("serialized secret key")
+	b.trusted("unread", root)
+	entries, err := parseJKS(b.finish(""), "", true)
+	if err != nil {
+		t.Fatalf("secret key entry: %s", err)
+	}
+	if len(entries) != 2 || entries[0].alias != "root" || entries[0].err != nil || entries[1].alias != "aes" || entries[1].err == nil {
+		t.Errorf("secret key entry: got %+v", entries)
+	}
+}
+
+func TestGetCertJKS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ks, leaf, _, root := testKeyStore(t, jksMagic, 2)
+	path := filepath.Join(dir, "keystore.jks")
+	if err := ioutil.WriteFile(path, ks, 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := GetCertJKS("example.com", path)
+	if len(r) != 2 {
+		t.Fatalf("got %d results", len(r))
+	}
+	if r[0].Name != "server" || r[0].Err != nil || !r[0].Values.Certificate.Equal(leaf.Cert) || r[0].Values.VerifyError != nil {
+		t.Errorf("server: got %+v", r[0])
+	}
+	if r[1].Name != "root" || r[1].Err != nil || !r[1].Values.Certificate.Equal(root.Cert) || r[1].Values.VerifyError != nil {
+		t.Errorf("root: got %+v", r[1])
+	}
+	if r := GetCertJKS("example.com", filepath.Join(dir, "missing.jks")); len(r) != 1 || r[0].Err == nil {
+		t.Errorf("missing keystore: got %+v", r)
+	}
+
+	b := &jksBuilder{version: 2}
+	b.header(jceksMagic, 2)
+	b.trusted("root", root)
+	b.u32(jksSecretKey)
+	b.utf("aes")
+	b.Write(make([]byte, 8))
+	path = filepath.Join(dir, "keystore.jceks")
+	if err := ioutil.WriteFile(path, b.finish(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r = GetCertJKS("example.com", path)
+	if len(r) != 2 {
+		t.Fatalf("secret key entry: got %d results", len(r))
+	}
+	if r[0].Name != "root" || r[0].Err != nil || !r[0].Values.Certificate.Equal(root.Cert) {
+		t.Errorf("secret key entry: root: got %+v", r[0])
+	}
+	if r[1].Name != "aes" || r[1].Err == nil || r[1].Values == nil {
+		t.Errorf("secret key entry: aes: got %+v", r[1])
+	}
+}
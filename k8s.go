@@ -0,0 +1,185 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// k8sObject holds the fields of Kubernetes resources used by the k8s-secret protocol.
+// Lists, like the output of kubectl get -o json for several secrets, contain their resources in Items.
+type k8sObject struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+	Spec       struct {
+		SecretName string `yaml:"secretName"`
+	} `yaml:"spec"`
+	Status struct {
+		NotAfter string `yaml:"notAfter"`
+	} `yaml:"status"`
+	Items []k8sObject `yaml:"items"`
+}
+
+// key returns namespace/name of the resource. Resources without namespace are in the default namespace.
+func (o *k8sObject) key(name string) string {
+	ns := o.Metadata.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+	return ns + "/" + name
+}
+
+func (o *k8sObject) isTLSSecret() bool {
+	return o.Kind == "Secret" && o.Type == "kubernetes.io/tls"
+}
+
+func (o *k8sObject) isCertificate() bool {
+	return o.Kind == "Certificate" && strings.HasPrefix(o.APIVersion, "cert-manager.io/")
+}
+
+// tlsCrt returns the decoded tls.crt of a secret.
+func (o *k8sObject) tlsCrt() ([]byte, error) {
+	if s, ok := o.StringData["tls.crt"]; ok {
+		return []byte(s), nil
+	}
+	s, ok := o.Data["tls.crt"]
+	if !ok {
+		return nil, ErrNoCert
+	}
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// parseK8sObjects returns the resources of the YAML or JSON documents d. Lists are flattened.
+func parseK8sObjects(d []byte) ([]k8sObject, error) {
+	var objs []k8sObject
+	var flatten func(o k8sObject)
+	flatten = func(o k8sObject) {
+		if strings.HasSuffix(o.Kind, "List") {
+			for _, i := range o.Items {
+				flatten(i)
+			}
+			return
+		}
+		objs = append(objs, o)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(d))
+	for {
+		var o k8sObject
+		err := dec.Decode(&o)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		flatten(o)
+	}
+	return objs, nil
+}
+
+// k8sSecretResults returns one result per TLS secret in objs, named namespace/name. The notAfter status of
+// cert-manager Certificates is compared with the certificate of their secret.
+func k8sSecretResults(objs []k8sObject) []FetchResult {
+	var r []FetchResult
+	secrets := make(map[string]*CertValues)
+	for i := range objs {
+		o := &objs[i]
+		if !o.isTLSSecret() {
+			continue
+		}
+		res := FetchResult{Name: o.key(o.Metadata.Name)}
+		d, err := o.tlsCrt()
+		var certs []*x509.Certificate
+		if err == nil {
+			certs, err = parsePEM(d)
+		}
+		if err == nil {
+			res.Values = verifyCerts("", certs, false)
+			secrets[res.Name] = res.Values
+		}
+		res.Err = err
+		r = append(r, res)
+	}
+	for i := range objs {
+		o := &objs[i]
+		if !o.isCertificate() {
+			continue
+		}
+		name := o.key(o.Spec.SecretName)
+		cv, ok := secrets[name]
+		if !ok {
+			r = append(r, FetchResult{
+				Name: o.key(o.Metadata.Name),
+				Err:  fmt.Errorf("certexpire: k8s: secret %s of certificate %s not found", name, o.Metadata.Name),
+			})
+			continue
+		}
+		if cv.VerifyError != nil {
+			continue
+		}
+		notAfter, err := time.Parse(time.RFC3339, o.Status.NotAfter)
+		if err != nil {
+			cv.VerifyError = fmt.Errorf("certexpire: k8s: certificate %s has no valid status.notAfter", o.Metadata.Name)
+		} else if !notAfter.Equal(cv.Expire) {
+			cv.VerifyError = fmt.Errorf("certexpire: k8s: certificate %s status.notAfter %s differs from secret",
+				o.Metadata.Name, notAfter.Format(time.RFC3339))
+		}
+	}
+	return r
+}
+
+// GetCertK8sSecret returns the certificates of the Kubernetes TLS secrets in the manifest file path,
+// one result per secret.
+func GetCertK8sSecret(ctx context.Context, servername, path string) []FetchResult {
+	return getCertK8sSecret(ctx, &Target{Hostname: servername, Param: path})
+}
+
+// getCertK8sSecret reads the Kubernetes manifests in the file t.Param, or the output of the command t.Param
+// if t.Options.Exec is set. The certificates are only checked for expiry.
+func getCertK8sSecret(ctx context.Context, t *Target) []FetchResult {
+	var d []byte
+	var err error
+	if t.Options.Exec {
+		d, err = runCommand(ctx, t)
+	} else {
+		d, err = ioutil.ReadFile(t.Param)
+	}
+	var r []FetchResult
+	if err == nil {
+		var objs []k8sObject
+		objs, err = parseK8sObjects(d)
+		r = k8sSecretResults(objs)
+	}
+	if err == nil && len(r) == 0 {
+		err = ErrNoCert
+	}
+	if err != nil {
+		r = []FetchResult{{Err: err}}
+	}
+	for i := range r {
+		if r[i].Values == nil {
+			r[i].Values = &CertValues{}
+		}
+		r[i].Values.Hostname = t.Hostname
+	}
+	return r
+}
+
+func init() {
+	RegisterProtocol("k8s-secret", MultiFetcherFunc(getCertK8sSecret))
+}
@@ -0,0 +1,52 @@
+package certexpire
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestK8sSecret(t *testing.T) {
+	for _, path := range []string{"testdata/k8s-secrets.yaml", "testdata/k8s-secrets.json"} {
+		r := GetCertK8sSecret(context.Background(), "example.com", path)
+		if len(r) != 3 {
+			t.Errorf("%s: got %d results, want 3: %+v", path, len(r), r)
+			continue
+		}
+		// TLS secret whose Certificate notAfter matches.
+		if r[0].Name != "web/www-tls" || r[0].Err != nil || r[0].Values.VerifyError != nil ||
+			!r[0].Values.Expire.Equal(time.Date(2049, 6, 30, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: www-tls: got %+v", path, r[0])
+		}
+		// TLS secret whose Certificate notAfter differs.
+		if r[1].Name != "web/api-tls" || r[1].Err != nil || r[1].Values.VerifyError == nil {
+			t.Errorf("%s: api-tls: got %+v", path, r[1])
+		}
+		// Certificate whose secret is missing.
+		if r[2].Name != "web/mail" || r[2].Err == nil {
+			t.Errorf("%s: mail: got %+v", path, r[2])
+		}
+		for _, res := range r {
+			if res.Values == nil || res.Values.Hostname != "example.com" {
+				t.Errorf("%s: %s: got values %+v", path, res.Name, res.Values)
+			}
+		}
+	}
+}
+
+func TestK8sSecretNoTLS(t *testing.T) {
+	objs, err := parseK8sObjects([]byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: x\ntype: Opaque\ndata:\n  password: c2VjcmV0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := k8sSecretResults(objs); len(r) != 0 {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestK8sSecretExec(t *testing.T) {
+	target := &Target{Hostname: "example.com", Param: "cat testdata/k8s-secrets.json", Protocol: "k8s-secret", Options: Options{Exec: true}}
+	if r := FetchCerts(context.Background(), target); len(r) != 3 || r[0].Err != nil {
+		t.Errorf("got %+v", r)
+	}
+}
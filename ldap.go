@@ -0,0 +1,155 @@
+package certexpire
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const ldapMaxMessage = 8192
+
+// ldapStartTLSRequest is an LDAPMessage with messageID 1 containing the StartTLS ExtendedRequest.
+var ldapStartTLSRequest = []byte{
+	0x30, 0x1d, // LDAPMessage SEQUENCE
+	0x02, 0x01, 0x01, // messageID 1
+	0x77, 0x18, // [APPLICATION 23] ExtendedRequest
+	0x80, 0x16, // [0] requestName
+	'1', '.', '3', '.', '6', '.', '1', '.', '4', '.', '1', '.', '1', '4', '6', '6', '.', '2', '0', '0', '3', '7',
+}
+
+// berNext splits the first BER element off b.
+func berNext(b []byte) (tag byte, value, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, ErrProtocol
+	}
+	tag, l := b[0], int(b[1])
+	b = b[2:]
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 3 || len(b) < n {
+			return 0, nil, nil, ErrProtocol
+		}
+		l = 0
+		for _, c := range b[:n] {
+			l = l<<8 | int(c)
+		}
+		b = b[n:]
+	}
+	if len(b) < l {
+		return 0, nil, nil, ErrProtocol
+	}
+	return tag, b[:l], b[l:], nil
+}
+
+// ldapReadMessage reads one complete BER encoded LDAPMessage.
+func ldapReadMessage(r io.Reader) ([]byte, error) {
+	h := make([]byte, 2)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	if h[0] != 0x30 {
+		return nil, ErrProtocol
+	}
+	msg := h
+	l := int(h[1])
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 3 {
+			return nil, ErrProtocol
+		}
+		ext := make([]byte, n)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		msg = append(msg, ext...)
+		l = 0
+		for _, c := range ext {
+			l = l<<8 | int(c)
+		}
+	}
+	if l > ldapMaxMessage {
+		return nil, ErrProtocol
+	}
+	body := make([]byte, l)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(msg, body...), nil
+}
+
+// ldapExtendedResult returns the resultCode and diagnosticMessage of an ExtendedResponse to messageID 1.
+func ldapExtendedResult(msg []byte) (code int, diag string, err error) {
+	_, m, _, err := berNext(msg)
+	if err != nil {
+		return 0, "", err
+	}
+	tag, id, m, err := berNext(m)
+	if err != nil {
+		return 0, "", err
+	}
+	// messageID 0 is an unsolicited notification, usually the server disconnecting us.
+	if tag != 0x02 || len(id) != 1 || (id[0] != 1 && id[0] != 0) {
+		return 0, "", ErrProtocol
+	}
+	tag, op, _, err := berNext(m)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0x78 { // [APPLICATION 24] ExtendedResponse
+		return 0, "", ErrProtocol
+	}
+	tag, rc, op, err := berNext(op)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0x0a || len(rc) == 0 { // ENUMERATED resultCode
+		return 0, "", ErrProtocol
+	}
+	for _, c := range rc {
+		code = code<<8 | int(c)
+	}
+	if _, _, op, err = berNext(op); err != nil { // matchedDN
+		return code, "", nil
+	}
+	if tag, d, _, err := berNext(op); err == nil && tag == 0x04 {
+		diag = string(d)
+	}
+	return code, diag, nil
+}
+
+func ldapprelude(conn net.Conn) error {
+	_, err := conn.Write(ldapStartTLSRequest)
+	if err != nil {
+		return err
+	}
+	msg, err := ldapReadMessage(conn)
+	if err != nil {
+		return err
+	}
+	code, diag, err := ldapExtendedResult(msg)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("certexpire: ldap StartTLS result %d: %s", code, diag)
+	}
+	return nil
+}
+
+// GetCertLDAP returns the expiration date of an LDAP StartTLS cert.
+func GetCertLDAP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertLDAPContext(ctx, servername, port, proxy)
+}
+
+// GetCertLDAPContext is like GetCertLDAP, but the retrieval is aborted when ctx is done.
+func GetCertLDAPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), ldapprelude)
+}
+
+func init() {
+	RegisterProtocol("ldap", preludeFetcher(ldapprelude))
+}
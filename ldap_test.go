@@ -0,0 +1,126 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ldapResponse returns an ExtendedResponse LDAPMessage with messageID id, result code and diagnostic message.
+func ldapResponse(id, code byte, diag string) []byte {
+	res := append([]byte{0x0a, 0x01, code, 0x04, 0x00, 0x04, byte(len(diag))}, diag...)
+	op := append([]byte{0x78, byte(len(res))}, res...)
+	msg := append([]byte{0x02, 0x01, id}, op...)
+	return append([]byte{0x30, byte(len(msg))}, msg...)
+}
+
+func TestBerNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		tag     byte
+		value   []byte
+		rest    []byte
+		wantErr bool
+	}{
+		{"short-form", []byte{0x04, 0x02, 'a', 'b', 0x05}, 0x04, []byte("ab"), []byte{0x05}, false},
+		{"long-form", append([]byte{0x04, 0x81, 0x03}, "abc"...), 0x04, []byte("abc"), []byte{}, false},
+		{"long-form-2", append([]byte{0x04, 0x82, 0x00, 0x01}, 'a'), 0x04, []byte("a"), []byte{}, false},
+		{"empty", nil, 0, nil, nil, true},
+		{"truncated-value", []byte{0x04, 0x03, 'a'}, 0, nil, nil, true},
+		{"truncated-length", []byte{0x04, 0x82, 0x00}, 0, nil, nil, true},
+		{"indefinite-length", []byte{0x30, 0x80, 0x00, 0x00}, 0, nil, nil, true},
+		{"length-too-long", []byte{0x04, 0x84, 0, 0, 0, 1, 'a'}, 0, nil, nil, true},
+	}
+	for _, test := range tests {
+		tag, value, rest, err := berNext(test.data)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if tag != test.tag || !bytes.Equal(value, test.value) || !bytes.Equal(rest, test.rest) {
+			t.Errorf("%s: got %x %x %x", test.name, tag, value, rest)
+		}
+	}
+}
+
+func TestLDAPExtendedResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     []byte
+		code    int
+		diag    string
+		wantErr bool
+	}{
+		{"success", ldapResponse(1, 0, ""), 0, "", false},
+		{"refused", ldapResponse(1, 2, "unsupported"), 2, "unsupported", false},
+		{"notice-of-disconnection", ldapResponse(0, 52, "shutting down"), 52, "shutting down", false},
+		{"wrong-message-id", ldapResponse(2, 0, ""), 0, "", true},
+		{"bind-response", []byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x61, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00}, 0, "", true},
+		{"no-result-code", []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x78, 0x00}, 0, "", true},
+		{"truncated", ldapResponse(1, 0, "")[:6], 0, "", true},
+	}
+	for _, test := range tests {
+		code, diag, err := ldapExtendedResult(test.msg)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if code != test.code || diag != test.diag {
+			t.Errorf("%s: got %d %q, want %d %q", test.name, code, diag, test.code, test.diag)
+		}
+	}
+}
+
+func TestLDAPReadMessage(t *testing.T) {
+	msg := ldapResponse(1, 0, strings.Repeat("x", 100))
+	long := append([]byte{0x30, 0x81, msg[1]}, msg[2:]...)
+	for _, m := range [][]byte{msg, long} {
+		r, err := ldapReadMessage(bytes.NewReader(append(m, 0x30)))
+		if err != nil || !bytes.Equal(r, m) {
+			t.Errorf("got %x, %v", r, err)
+		}
+	}
+	if _, err := ldapReadMessage(bytes.NewReader([]byte{0x04, 0x00})); !errors.Is(err, ErrProtocol) {
+		t.Errorf("no sequence: got error %v, want %v", err, ErrProtocol)
+	}
+	if _, err := ldapReadMessage(bytes.NewReader([]byte{0x30, 0x83, 0xff, 0xff, 0xff})); !errors.Is(err, ErrProtocol) {
+		t.Errorf("oversized: got error %v, want %v", err, ErrProtocol)
+	}
+}
+
+// ldapServer expects the StartTLS request and replies with resp. The TLS handshake with cert follows.
+func ldapServer(t *testing.T, resp []byte, cert *testCert) string {
+	return fakeServer(t, func(conn net.Conn) {
+		req, err := ldapReadMessage(conn)
+		if err != nil || !bytes.Equal(req, ldapStartTLSRequest) {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+		serveTLS(conn, cert.TLS())
+	})
+}
+
+func TestLDAP(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cv, err := GetCertLDAPContext(ctx, "localhost", ldapServer(t, ldapResponse(1, 0, ""), cert), nil)
+	if err != nil {
+		t.Fatalf("success: %s", err)
+	}
+	if !cv.Certificate.Equal(cert.Cert) {
+		t.Error("success: wrong certificate")
+	}
+	_, err = GetCertLDAPContext(ctx, "localhost", ldapServer(t, ldapResponse(1, 2, "unsupported"), cert), nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("refused: got error %v", err)
+	}
+}
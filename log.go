@@ -92,24 +92,37 @@ func (rep *Report) Status(s string) {
 	rep.Logger.Log(MsgStatus, s)
 }
 
+// checkName identifies the check in log lines.
+func checkName(sc *ServerCheck) string {
+	if sc.Source != "" {
+		return fmt.Sprintf("%s:%s@%s", sc.Hostname, sc.Param, sc.Source)
+	}
+	return fmt.Sprintf("%s:%s", sc.Hostname, sc.Param)
+}
+
 func (rep *Report) LogStatus(sc *ServerCheck) {
-	rep.Logger.Log(MsgLogStatus, fmt.Sprintf("%s:%s", sc.Hostname, sc.Param))
+	rep.Logger.Log(MsgLogStatus, checkName(sc))
 }
 
 func (rep *Report) LogError(sc *ServerCheck) {
 	var errors []string
 	var extra string
+	var expires bool
 	for _, l := range sc.Error {
 		if l == ErrHash {
 			extra += fmt.Sprintf(",Hash=%s", sc.ReturnHash)
 		}
-		if l == ErrExpire {
+		if l == ErrPin {
+			extra += fmt.Sprintf(",Pin=%s", sc.ReturnPin)
+		}
+		if _, ok := l.(*ExpireError); (ok || l == ErrExpire) && !expires {
 			extra += fmt.Sprintf(",Expires=%s", sc.ExpireTime.Format("2006-01-02"))
+			expires = true
 		}
 		errors = append(errors, l.Error())
 	}
 	if sc.ExecuteError != nil {
 		errors = append(errors, sc.ExecuteError.Error())
 	}
-	rep.Logger.Log(MsgLogError, fmt.Sprintf("%s:%s,[\"%s\"]%s", sc.Hostname, sc.Param, strings.Join(errors, "\", \""), extra))
+	rep.Logger.Log(MsgLogError, fmt.Sprintf("%s,[\"%s\"]%s", checkName(sc), strings.Join(errors, "\", \""), extra))
 }
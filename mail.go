@@ -3,6 +3,7 @@ package certexpire
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"net/smtp"
 	"text/template"
 )
@@ -40,7 +41,7 @@ func (rep *Report) SendReport(ce ConfigEntry) {
 		rep.Error(fmt.Sprintf("Email: %s", ce.MailTo))
 		return
 	}
-	err := smtp.SendMail(rep.MailHostname+":"+rep.MailPort, auth, rep.MailFrom, []string{ce.MailTo}, msg)
+	err := smtp.SendMail(net.JoinHostPort(rep.MailHostname, rep.MailPort), auth, rep.MailFrom, []string{ce.MailTo}, msg)
 	if err != nil {
 		rep.Error(fmt.Sprintf("Email: %s", err))
 	} else {
@@ -7,7 +7,7 @@ Subject: SSL certificates check failed
 The following servers have failed the TLS certificate check:
 {{ range $e := .Report.Checks }}
 {{- if or $e.Error $e.ExecuteError }}
-{{ $e.Hostname }}:{{ $e.Param}} ({{$e.Protocol}}): Expires {{ $e.ExpireTime }}
+{{ $e.Hostname }}:{{ $e.Param}}{{ if $e.Source }}@{{ $e.Source }}{{ end }} ({{$e.Protocol}}): Expires {{ $e.ExpireTime }}
 {{ if $e.Error -}} {{- range $err := $e.Error }} ==> {{ $err}} {{- end}} {{- end}} 
 {{ if $e.ExecuteError -}} ==> ({{$e.ExecuteError}}) {{- end -}} 
 {{- end -}}
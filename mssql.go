@@ -0,0 +1,173 @@
+package certexpire
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	tdsPacketPrelogin = 0x12
+	tdsPacketReply    = 0x04
+	tdsStatusEOM      = 0x01
+	tdsHeaderSize     = 8
+	tdsMaxPacket      = 4096
+
+	tdsPreloginVersion    = 0x00
+	tdsPreloginEncryption = 0x01
+	tdsPreloginTerminator = 0xff
+
+	tdsEncryptOn     = 0x01
+	tdsEncryptNotSup = 0x02
+)
+
+// tdsWritePacket writes data as TDS packets of type t.
+func tdsWritePacket(w io.Writer, t byte, data []byte) error {
+	var id byte
+	for {
+		id++
+		n := len(data)
+		if n > tdsMaxPacket-tdsHeaderSize {
+			n = tdsMaxPacket - tdsHeaderSize
+		}
+		p := make([]byte, tdsHeaderSize+n)
+		p[0] = t
+		if n == len(data) {
+			p[1] = tdsStatusEOM
+		}
+		binary.BigEndian.PutUint16(p[2:4], uint16(len(p)))
+		p[6] = id
+		copy(p[tdsHeaderSize:], data[:n])
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// tdsReadPacket reads one TDS packet and returns type, status and payload.
+func tdsReadPacket(r io.Reader) (t, status byte, payload []byte, err error) {
+	h := make([]byte, tdsHeaderSize)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, 0, nil, err
+	}
+	l := int(binary.BigEndian.Uint16(h[2:4]))
+	if l < tdsHeaderSize {
+		return 0, 0, nil, ErrProtocol
+	}
+	payload = make([]byte, l-tdsHeaderSize)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return h[0], h[1], payload, nil
+}
+
+// tdsPrelogin returns a PRELOGIN message requesting encryption.
+func tdsPrelogin() []byte {
+	// Two options of 5 bytes each plus terminator, followed by the option data.
+	const dataOffset = 5 + 5 + 1
+	p := []byte{
+		tdsPreloginVersion, 0, dataOffset, 0, 6,
+		tdsPreloginEncryption, 0, dataOffset + 6, 0, 1,
+		tdsPreloginTerminator,
+	}
+	p = append(p, 0, 0, 0, 0, 0, 0) // Version 0.0.0, sub build 0.
+	return append(p, tdsEncryptOn)
+}
+
+// tdsEncryption returns the ENCRYPTION option of a PRELOGIN response.
+func tdsEncryption(p []byte) (byte, error) {
+	for o := 0; o+5 <= len(p) && p[o] != tdsPreloginTerminator; o += 5 {
+		if p[o] != tdsPreloginEncryption {
+			continue
+		}
+		off, l := int(binary.BigEndian.Uint16(p[o+1:o+3])), int(binary.BigEndian.Uint16(p[o+3:o+5]))
+		if l < 1 || off+l > len(p) {
+			return 0, ErrProtocol
+		}
+		return p[off], nil
+	}
+	return 0, ErrProtocol
+}
+
+func mssqlprelude(conn net.Conn) error {
+	if err := tdsWritePacket(conn, tdsPacketPrelogin, tdsPrelogin()); err != nil {
+		return err
+	}
+	t, _, p, err := tdsReadPacket(conn)
+	if err != nil {
+		return err
+	}
+	if t != tdsPacketReply {
+		return ErrProtocol
+	}
+	enc, err := tdsEncryption(p)
+	if err != nil {
+		return err
+	}
+	if enc == tdsEncryptNotSup {
+		return ErrNoTLS
+	}
+	return nil
+}
+
+// tdsConn frames the TLS handshake in TDS PRELOGIN packets, as SQL Server expects it.
+type tdsConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *tdsConn) Read(b []byte) (int, error) {
+	for len(c.buf) == 0 {
+		_, _, p, err := tdsReadPacket(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.buf = p
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *tdsConn) Write(b []byte) (int, error) {
+	if err := tdsWritePacket(c.Conn, tdsPacketPrelogin, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// GetCertMSSQL returns the expiration date of a Microsoft SQL Server cert.
+func GetCertMSSQL(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertMSSQLContext(ctx, servername, port, proxy)
+}
+
+// GetCertMSSQLContext is like GetCertMSSQL, but the retrieval is aborted when ctx is done.
+func GetCertMSSQLContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertMSSQL(ctx, newTarget(servername, port, proxy))
+}
+
+func getCertMSSQL(ctx context.Context, t *Target) (*CertValues, error) {
+	conn, err := TCPDailerContext(ctx, t.DialAddr(), t.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := watchConn(ctx, conn)
+	defer stop()
+	if err := mssqlprelude(conn); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return GetCertificateTarget(ctx, &tdsConn{Conn: conn}, t)
+}
+
+func init() {
+	RegisterProtocol("mssql", FetcherFunc(getCertMSSQL))
+}
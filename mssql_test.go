@@ -0,0 +1,132 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// tdsPreloginResponse returns a PRELOGIN response with the VERSION and ENCRYPTION options.
+func tdsPreloginResponse(enc byte) []byte {
+	return []byte{
+		tdsPreloginVersion, 0, 11, 0, 6,
+		tdsPreloginEncryption, 0, 17, 0, 1,
+		tdsPreloginTerminator,
+		15, 0, 0x07, 0xd0, 0, 0,
+		enc,
+	}
+}
+
+func TestTDSEncryption(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		enc     byte
+		wantErr bool
+	}{
+		{"on", tdsPreloginResponse(tdsEncryptOn), tdsEncryptOn, false},
+		{"not-supported", tdsPreloginResponse(tdsEncryptNotSup), tdsEncryptNotSup, false},
+		{"request", tdsPrelogin(), tdsEncryptOn, false},
+		{"no-encryption-option", []byte{tdsPreloginVersion, 0, 6, 0, 6, tdsPreloginTerminator, 15, 0, 0x07, 0xd0, 0, 0}, 0, true},
+		{"offset-out-of-range", []byte{tdsPreloginEncryption, 0, 6, 0, 1, tdsPreloginTerminator}, 0, true},
+		{"zero-length", []byte{tdsPreloginEncryption, 0, 6, 0, 0, tdsPreloginTerminator, 1}, 0, true},
+		{"truncated-option", []byte{tdsPreloginEncryption, 0, 6}, 0, true},
+		{"empty", nil, 0, true},
+	}
+	for _, test := range tests {
+		enc, err := tdsEncryption(test.data)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if enc != test.enc {
+			t.Errorf("%s: got encryption %d, want %d", test.name, enc, test.enc)
+		}
+	}
+}
+
+func TestTDSPackets(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	var b bytes.Buffer
+	if err := tdsWritePacket(&b, tdsPacketPrelogin, data); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(b.Bytes())
+	var got []byte
+	for i := 0; ; i++ {
+		typ, status, p, err := tdsReadPacket(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != tdsPacketPrelogin || len(p) > tdsMaxPacket-tdsHeaderSize {
+			t.Fatalf("packet %d: type %d, length %d", i, typ, len(p))
+		}
+		got = append(got, p...)
+		if status == tdsStatusEOM {
+			if i != 2 {
+				t.Errorf("got %d packets, want 3", i+1)
+			}
+			break
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("payload differs")
+	}
+	// tdsConn reads across packet boundaries.
+	got, err := ioutil.ReadAll(&tdsConn{Conn: &readConn{Reader: bytes.NewReader(b.Bytes())}})
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("tdsConn: payload differs, %v", err)
+	}
+	if _, _, _, err := tdsReadPacket(bytes.NewReader([]byte{tdsPacketReply, 1, 0, 4, 0, 0, 0, 0})); !errors.Is(err, ErrProtocol) {
+		t.Errorf("short length: got error %v, want %v", err, ErrProtocol)
+	}
+}
+
+// readConn is a net.Conn that reads from Reader.
+type readConn struct {
+	net.Conn
+	Reader *bytes.Reader
+}
+
+func (c *readConn) Read(b []byte) (int, error) {
+	return c.Reader.Read(b)
+}
+
+// mssqlServer answers the PRELOGIN request with enc. The TLS handshake with cert follows in PRELOGIN packets.
+func mssqlServer(t *testing.T, enc byte, cert *testCert) string {
+	return fakeServer(t, func(conn net.Conn) {
+		typ, _, p, err := tdsReadPacket(conn)
+		if err != nil || typ != tdsPacketPrelogin || !bytes.Equal(p, tdsPrelogin()) {
+			return
+		}
+		if err := tdsWritePacket(conn, tdsPacketReply, tdsPreloginResponse(enc)); err != nil {
+			return
+		}
+		_ = tls.Server(&tdsConn{Conn: conn}, &tls.Config{Certificates: []tls.Certificate{cert.TLS()}}).Handshake()
+	})
+}
+
+func TestMSSQL(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cv, err := GetCertMSSQLContext(ctx, "localhost", mssqlServer(t, tdsEncryptOn, cert), nil)
+	if err != nil {
+		t.Fatalf("encryption on: %s", err)
+	}
+	if cv.Certificate == nil {
+		t.Fatalf("encryption on: no certificate, %v", cv.VerifyError)
+	}
+	if !cv.Certificate.Equal(cert.Cert) {
+		t.Error("encryption on: wrong certificate")
+	}
+	if _, err := GetCertMSSQLContext(ctx, "localhost", mssqlServer(t, tdsEncryptNotSup, cert), nil); !errors.Is(err, ErrNoTLS) {
+		t.Errorf("encryption not supported: got error %v, want %v", err, ErrNoTLS)
+	}
+}
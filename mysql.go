@@ -0,0 +1,107 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	mysqlClientLongPassword     = 0x00000001
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSSL              = 0x00000800
+	mysqlClientSecureConnection = 0x00008000
+	mysqlMaxHandshake           = 8192
+)
+
+// mysqlReadPacket reads one packet of the MySQL client/server protocol.
+func mysqlReadPacket(r io.Reader) (seq byte, payload []byte, err error) {
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, nil, err
+	}
+	l := int(h[0]) | int(h[1])<<8 | int(h[2])<<16
+	if l > mysqlMaxHandshake {
+		return 0, nil, ErrProtocol
+	}
+	payload = make([]byte, l)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return h[3], payload, nil
+}
+
+// mysqlCapabilities returns the capability flags of an initial handshake packet (protocol version 10).
+func mysqlCapabilities(p []byte) (uint32, error) {
+	if len(p) == 0 {
+		return 0, ErrProtocol
+	}
+	if p[0] == 0xff {
+		// Error packet: code, then message. Servers use this to refuse clients, e.g. blocked hosts.
+		if len(p) < 3 {
+			return 0, ErrProtocol
+		}
+		return 0, fmt.Errorf("certexpire: mysql error %d: %s", binary.LittleEndian.Uint16(p[1:3]), p[3:])
+	}
+	if p[0] != 10 {
+		return 0, ErrProtocol
+	}
+	// Server version is NUL terminated, followed by connection id (4), auth data (8) and filler (1).
+	e := bytes.IndexByte(p[1:], 0)
+	if e < 0 {
+		return 0, ErrProtocol
+	}
+	p = p[1+e+1:]
+	if len(p) < 4+8+1+2 {
+		return 0, ErrProtocol
+	}
+	caps := uint32(binary.LittleEndian.Uint16(p[13:15]))
+	// Charset (1) and status (2) precede the upper capability flags.
+	if len(p) >= 15+1+2+2 {
+		caps |= uint32(binary.LittleEndian.Uint16(p[18:20])) << 16
+	}
+	return caps, nil
+}
+
+func mysqlprelude(conn net.Conn) error {
+	seq, p, err := mysqlReadPacket(conn)
+	if err != nil {
+		return err
+	}
+	caps, err := mysqlCapabilities(p)
+	if err != nil {
+		return err
+	}
+	if caps&mysqlClientSSL == 0 {
+		return ErrNoTLS
+	}
+	// SSLRequest: capabilities (4), max packet size (4), charset (1), 23 bytes reserved.
+	req := make([]byte, 4+32)
+	req[0] = 32
+	req[3] = seq + 1
+	binary.LittleEndian.PutUint32(req[4:], mysqlClientLongPassword|mysqlClientProtocol41|mysqlClientSSL|mysqlClientSecureConnection)
+	binary.LittleEndian.PutUint32(req[8:], 1<<24)
+	req[12] = 33 // utf8_general_ci
+	_, err = conn.Write(req)
+	return err
+}
+
+// GetCertMySQL returns the expiration date of a MySQL/MariaDB server cert.
+func GetCertMySQL(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertMySQLContext(ctx, servername, port, proxy)
+}
+
+// GetCertMySQLContext is like GetCertMySQL, but the retrieval is aborted when ctx is done.
+func GetCertMySQLContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), mysqlprelude)
+}
+
+func init() {
+	RegisterProtocol("mysql", preludeFetcher(mysqlprelude))
+}
@@ -0,0 +1,102 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// mysqlHandshake returns an initial handshake packet payload with the capability flags caps.
+func mysqlHandshake(caps uint32) []byte {
+	var b bytes.Buffer
+	b.WriteByte(10)
+	b.WriteString("5.7.99-test\x00")
+	b.Write([]byte{1, 0, 0, 0}) // connection id
+	b.WriteString("abcdefgh")   // auth data
+	b.WriteByte(0)              // filler
+	b.Write([]byte{byte(caps), byte(caps >> 8)})
+	b.WriteByte(33)       // charset
+	b.Write([]byte{2, 0}) // status
+	b.Write([]byte{byte(caps >> 16), byte(caps >> 24)})
+	b.WriteByte(21)                   // auth data length
+	b.Write(make([]byte, 10))         // reserved
+	b.WriteString("ijklmnopqrst\x00") // auth data, part 2
+	b.WriteString("mysql_native_password\x00")
+	return b.Bytes()
+}
+
+func TestMySQLCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		caps    uint32
+		wantErr bool
+	}{
+		{"ssl", mysqlHandshake(0x000fffff), 0x000fffff, false},
+		{"no-ssl", mysqlHandshake(0x000ff7ff), 0x000ff7ff, false},
+		{"no-upper-flags", mysqlHandshake(0xf7ff)[:1+12+4+8+1+2], 0xf7ff, false},
+		{"empty", nil, 0, true},
+		{"version-9", append([]byte{9}, mysqlHandshake(0xffff)[1:]...), 0, true},
+		{"no-version-end", []byte{10, '5', '.', '7'}, 0, true},
+		{"short", mysqlHandshake(0xffff)[:1+12+4], 0, true},
+		{"error-packet", []byte{0xff, 0x69, 0x04, 'H', 'o', 's', 't'}, 0, true},
+		{"short-error-packet", []byte{0xff, 0x69}, 0, true},
+	}
+	for _, test := range tests {
+		caps, err := mysqlCapabilities(test.packet)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if caps != test.caps {
+			t.Errorf("%s: got capabilities %x, want %x", test.name, caps, test.caps)
+		}
+	}
+}
+
+// mysqlServer sends a handshake with caps and expects the SSL request, followed by the TLS handshake with cert.
+func mysqlServer(t *testing.T, caps uint32, cert *testCert) string {
+	return fakeServer(t, func(conn net.Conn) {
+		p := mysqlHandshake(caps)
+		h := []byte{byte(len(p)), byte(len(p) >> 8), byte(len(p) >> 16), 0}
+		if _, err := conn.Write(append(h, p...)); err != nil {
+			return
+		}
+		seq, req, err := mysqlReadPacket(conn)
+		if err != nil || seq != 1 || len(req) != 32 || binary.LittleEndian.Uint32(req)&mysqlClientSSL == 0 {
+			return
+		}
+		serveTLS(conn, cert.TLS())
+	})
+}
+
+func TestMySQL(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cv, err := GetCertMySQLContext(ctx, "localhost", mysqlServer(t, 0x000fffff, cert), nil)
+	if err != nil {
+		t.Fatalf("ssl: %s", err)
+	}
+	if !cv.Certificate.Equal(cert.Cert) {
+		t.Error("ssl: wrong certificate")
+	}
+	if _, err := GetCertMySQLContext(ctx, "localhost", mysqlServer(t, 0x000ff7ff, cert), nil); !errors.Is(err, ErrNoTLS) {
+		t.Errorf("no-ssl: got error %v, want %v", err, ErrNoTLS)
+	}
+}
+
+func TestMySQLReadPacket(t *testing.T) {
+	if _, _, err := mysqlReadPacket(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0})); !errors.Is(err, ErrProtocol) {
+		t.Errorf("oversized packet: got error %v, want %v", err, ErrProtocol)
+	}
+	if _, _, err := mysqlReadPacket(bytes.NewReader([]byte{4, 0, 0, 0, 1})); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated packet: got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
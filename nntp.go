@@ -0,0 +1,41 @@
+package certexpire
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// nntpCapabilities fails with ErrNoTLS if the capability list lacks STARTTLS. Servers without CAPABILITIES are tried anyway.
+func nntpCapabilities(rep *textReply) error {
+	if rep.code != "101" {
+		return nil
+	}
+	return expectCapability(hasWord("STARTTLS"))(rep)
+}
+
+var nntpScript = []textStep{
+	{read: readStatusList, expect: []textCheck{expectCode("200", "201")}},
+	{send: "CAPABILITIES\r\n", read: readStatusList, expect: []textCheck{nntpCapabilities}},
+	{send: "STARTTLS\r\n", read: readStatusList, expect: []textCheck{expectCode("382")}},
+}
+
+func nntpprelude(conn net.Conn) error {
+	return runTextScript(conn, nntpScript)
+}
+
+// GetCertNNTP returns the expiration date of an NNTP STARTTLS cert.
+func GetCertNNTP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertNNTPContext(ctx, servername, port, proxy)
+}
+
+// GetCertNNTPContext is like GetCertNNTP, but the retrieval is aborted when ctx is done.
+func GetCertNNTPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), nntpprelude)
+}
+
+func init() {
+	RegisterProtocol("nntp", preludeFetcher(nntpprelude))
+}
@@ -0,0 +1,122 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSP modes of a check.
+const (
+	OCSPOff    = ""       // No revocation check.
+	OCSPOn     = "on"     // Use the stapled response, or query the responder of the certificate.
+	OCSPStaple = "staple" // Like OCSPOn, but a missing stapled response is reported.
+)
+
+// OCSPStapleDeadline is the default warning duration before a stapled OCSP response expires.
+const OCSPStapleDeadline = 24 * time.Hour
+
+// Values of CertValues.OCSPStatus.
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+)
+
+// ocspIssuer returns the issuer of the leaf, from the verified chain or else the served chain.
+func ocspIssuer(served []*x509.Certificate, chains [][]*x509.Certificate) *x509.Certificate {
+	if len(chains) > 0 && len(chains[0]) > 1 {
+		return chains[0][1]
+	}
+	if len(served) > 1 && served[0].CheckSignatureFrom(served[1]) == nil {
+		return served[1]
+	}
+	return nil
+}
+
+// queryOCSP asks the OCSP responder of leaf for its status. The request uses the proxy of t.
+func queryOCSP(ctx context.Context, t *Target, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, errors.New("no OCSP responder in certificate")
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, "POST", leaf.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/ocsp-request")
+	// Each query has its own transport, as the proxy depends on the check. Keep-alives would leave idle
+	// connections behind.
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return TCPDailerContext(ctx, addr, t.Proxy)
+		},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Do(hreq)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("responder %s: %s", leaf.OCSPServer[0], resp.Status)
+	}
+	d, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return ocsp.ParseResponseForCert(d, leaf, issuer)
+}
+
+// checkOCSP sets the revocation status of leaf in cv. The stapled response is used if present, otherwise the
+// responder of leaf is queried. Problems are added to cv.OCSPErrors.
+func checkOCSP(ctx context.Context, t *Target, cv *CertValues, staple []byte, leaf, issuer *x509.Certificate) {
+	if issuer == nil {
+		cv.OCSPErrors = append(cv.OCSPErrors, errors.New("certexpire: ocsp: issuer not found"))
+		return
+	}
+	var resp *ocsp.Response
+	var err error
+	if len(staple) > 0 {
+		resp, err = ocsp.ParseResponseForCert(staple, leaf, issuer)
+		deadline := t.Options.OCSPDeadline
+		if deadline == 0 {
+			deadline = OCSPStapleDeadline
+		}
+		if err == nil && !resp.NextUpdate.IsZero() && time.Now().Add(deadline).After(resp.NextUpdate) {
+			cv.OCSPErrors = append(cv.OCSPErrors, ErrOCSPStapleExpire)
+		}
+	} else {
+		if t.Options.OCSP == OCSPStaple {
+			cv.OCSPErrors = append(cv.OCSPErrors, ErrOCSPNoStaple)
+		}
+		resp, err = queryOCSP(ctx, t, leaf, issuer)
+	}
+	if err != nil {
+		cv.OCSPErrors = append(cv.OCSPErrors, fmt.Errorf("certexpire: ocsp: %s", err))
+		return
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		cv.OCSPStatus = OCSPGood
+	case ocsp.Revoked:
+		cv.OCSPStatus = OCSPRevoked
+		cv.OCSPErrors = append(cv.OCSPErrors, ErrRevoked)
+	default:
+		cv.OCSPStatus = OCSPUnknown
+		cv.OCSPErrors = append(cv.OCSPErrors, ErrOCSPUnknown)
+	}
+}
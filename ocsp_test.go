@@ -0,0 +1,143 @@
+package certexpire
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspResponder stands in for the OCSP responder of issuer. It answers requests for leaf with status.
+type ocspResponder struct {
+	t       *testing.T
+	issuer  *testCert
+	leaf    *x509.Certificate
+	status  int
+	queries int32
+}
+
+// response returns a response signed by issuer for cert, valid until nextUpdate.
+func (o *ocspResponder) response(t *testing.T, cert *x509.Certificate, status int, nextUpdate time.Time) []byte {
+	tmpl := ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   nextUpdate,
+	}
+	if status == ocsp.Revoked {
+		tmpl.RevokedAt = time.Now().Add(-time.Hour)
+		tmpl.RevocationReason = ocsp.KeyCompromise
+	}
+	d, err := ocsp.CreateResponse(o.issuer.Cert, o.issuer.Cert, tmpl, o.issuer.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func (o *ocspResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&o.queries, 1)
+	d, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	req, err := ocsp.ParseRequest(d)
+	if err != nil || req.SerialNumber.Cmp(o.leaf.SerialNumber) != 0 || req.HashAlgorithm != crypto.SHA1 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(o.response(o.t, o.leaf, o.status, time.Now().Add(7*24*time.Hour)))
+}
+
+func TestOCSP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expire := time.Now().Add(30 * 24 * time.Hour)
+	root := newTestCert(t, "Test Root", expire, nil)
+	inter := newTestCert(t, "Test Intermediate", expire, root, asCA)
+	responder := &ocspResponder{t: t, issuer: inter}
+	srv := httptest.NewServer(responder)
+	defer srv.Close()
+	leaf := newTestCert(t, "localhost", expire, inter, func(c *x509.Certificate) {
+		c.OCSPServer = []string{srv.URL}
+	})
+	responder.leaf = leaf.Cert
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, root.PEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		status   int    // Status of the responder.
+		staple   []byte // Stapled response, if any.
+		queries  int32  // Queries the responder must get.
+		ocspStat string
+		errs     []error
+	}{
+		{"good", OCSPOn, ocsp.Good, nil, 1, OCSPGood, nil},
+		{"revoked", OCSPOn, ocsp.Revoked, nil, 1, OCSPRevoked, []error{ErrRevoked}},
+		{"unknown", OCSPOn, ocsp.Unknown, nil, 1, OCSPUnknown, []error{ErrOCSPUnknown}},
+		{"missing-staple", OCSPStaple, ocsp.Good, nil, 1, OCSPGood, []error{ErrOCSPNoStaple}},
+		{"staple", OCSPStaple, ocsp.Revoked, responder.response(t, leaf.Cert, ocsp.Good, time.Now().Add(7*24*time.Hour)), 0, OCSPGood, nil},
+		{"staple-revoked", OCSPOn, ocsp.Good, responder.response(t, leaf.Cert, ocsp.Revoked, time.Now().Add(7*24*time.Hour)), 0, OCSPRevoked, []error{ErrRevoked}},
+		{"staple-expires", OCSPOn, ocsp.Good, responder.response(t, leaf.Cert, ocsp.Good, time.Now().Add(time.Hour)), 0, OCSPGood, []error{ErrOCSPStapleExpire}},
+	}
+	for _, test := range tests {
+		responder.status = test.status
+		atomic.StoreInt32(&responder.queries, 0)
+		cert := leaf.TLS(inter)
+		cert.OCSPStaple = test.staple
+		port := fakeServer(t, func(conn net.Conn) {
+			_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cv, err := FetchCert(ctx, &Target{
+			Hostname: "localhost",
+			Param:    port,
+			Protocol: "tls",
+			Options:  Options{OCSP: test.mode, CAFile: caFile, Trust: TrustReplace},
+		})
+		cancel()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if cv.VerifyError != nil {
+			t.Errorf("%s: verify error %s", test.name, cv.VerifyError)
+		}
+		if cv.OCSPStatus != test.ocspStat {
+			t.Errorf("%s: got status %q, want %q", test.name, cv.OCSPStatus, test.ocspStat)
+		}
+		if len(cv.OCSPErrors) != len(test.errs) {
+			t.Errorf("%s: got errors %v, want %v", test.name, cv.OCSPErrors, test.errs)
+		} else {
+			for i, e := range test.errs {
+				if cv.OCSPErrors[i] != e {
+					t.Errorf("%s: got errors %v, want %v", test.name, cv.OCSPErrors, test.errs)
+					break
+				}
+			}
+		}
+		if q := atomic.LoadInt32(&responder.queries); q != test.queries {
+			t.Errorf("%s: responder got %d queries, want %d", test.name, q, test.queries)
+		}
+	}
+}
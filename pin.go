@@ -0,0 +1,68 @@
+package certexpire
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+)
+
+// Pin types, selecting what the pins of a check are compared with.
+const (
+	PinSPKI   = "spki"   // Base64 SHA-256 of the leaf's SubjectPublicKeyInfo, as in HPKP. Survives renewals with the same key.
+	PinIssuer = "issuer" // Base64 SHA-256 of the SubjectPublicKeyInfo of any issuer or intermediate in the chain.
+	PinCert   = "cert"   // SHA-512 of the leaf certificate, like the hash of the check.
+)
+
+// spkiPin returns the HPKP-style pin of cert.
+func spkiPin(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// normalizePin removes the optional sha256/ prefix of SPKI pins, as written by curl and HPKP headers.
+func normalizePin(pin, pinType string) string {
+	if pinType == PinCert {
+		return strings.ToLower(pin)
+	}
+	if strings.HasPrefix(pin, "sha256/") {
+		return strings.TrimPrefix(pin[len("sha256/"):], "/")
+	}
+	return pin
+}
+
+// pinValues returns the values of cv that pins of pinType may match.
+func pinValues(cv *CertValues, pinType string) []string {
+	if cv.Certificate == nil {
+		return nil
+	}
+	switch pinType {
+	case PinIssuer:
+		var r []string
+		for _, c := range cv.Chain {
+			if !c.Equal(cv.Certificate) {
+				r = append(r, spkiPin(c))
+			}
+		}
+		return r
+	case PinCert:
+		return []string{cv.Hash}
+	default:
+		return []string{spkiPin(cv.Certificate)}
+	}
+}
+
+// matchPins reports whether any of pins matches cv. It also returns the values that were compared,
+// which can be used as pins.
+func matchPins(cv *CertValues, pins []string, pinType string) (bool, []string) {
+	values := pinValues(cv, pinType)
+	for _, p := range pins {
+		p = normalizePin(p, pinType)
+		for _, v := range values {
+			if p == v {
+				return true, values
+			}
+		}
+	}
+	return false, values
+}
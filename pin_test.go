@@ -0,0 +1,101 @@
+package certexpire
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchPins(t *testing.T) {
+	leaf, inter, root := testChain(t, "example.com")
+	cv := verifyCerts("", []*x509.Certificate{leaf.Cert, inter.Cert, root.Cert}, false)
+	h := sha256.Sum256(leaf.Cert.RawSubjectPublicKeyInfo)
+	spki := base64.StdEncoding.EncodeToString(h[:])
+	if p := spkiPin(leaf.Cert); p != spki {
+		t.Fatalf("got spki pin %s, want %s", p, spki)
+	}
+	other := spkiPin(newTestCert(t, "example.com", time.Now().Add(time.Hour), nil).Cert)
+
+	tests := []struct {
+		name    string
+		pins    []string
+		pinType string
+		match   bool
+	}{
+		{"spki", []string{spki}, PinSPKI, true},
+		{"spki-default", []string{spki}, "", true},
+		{"spki-prefix", []string{"sha256/" + spki}, PinSPKI, true},
+		{"spki-prefix-double-slash", []string{"sha256//" + spki}, PinSPKI, true},
+		{"spki-other-key", []string{other}, PinSPKI, false},
+		{"spki-of-issuer", []string{spkiPin(inter.Cert)}, PinSPKI, false},
+		{"issuer-intermediate", []string{spkiPin(inter.Cert)}, PinIssuer, true},
+		{"issuer-root", []string{"sha256/" + spkiPin(root.Cert)}, PinIssuer, true},
+		{"issuer-of-leaf", []string{spki}, PinIssuer, false},
+		{"cert", []string{cv.Hash}, PinCert, true},
+		{"cert-upper", []string{strings.ToUpper(cv.Hash)}, PinCert, true},
+		{"cert-spki", []string{spki}, PinCert, false},
+		{"several-one-matches", []string{other, "sha256/" + spki, "bogus"}, PinSPKI, true},
+		{"several-none-matches", []string{other, "bogus"}, PinSPKI, false},
+	}
+	for _, test := range tests {
+		if ok, _ := matchPins(cv, test.pins, test.pinType); ok != test.match {
+			t.Errorf("%s: got match %t, want %t", test.name, ok, test.match)
+		}
+	}
+
+	if _, values := matchPins(cv, []string{other}, PinIssuer); len(values) != 2 {
+		t.Errorf("issuer: got values %v, want the pins of intermediate and root", values)
+	}
+	if ok, _ := matchPins(&CertValues{}, []string{spki}, PinSPKI); ok {
+		t.Error("no certificate: pin matched")
+	}
+}
+
+func TestVerifyPins(t *testing.T) {
+	leaf, inter, root := testChain(t, "example.com")
+	cv := verifyCerts("", []*x509.Certificate{leaf.Cert, inter.Cert, root.Cert}, false)
+	spki := spkiPin(leaf.Cert)
+
+	sc := &ServerCheck{Options: Options{Pins: []string{spkiPin(root.Cert)}}}
+	if err := sc.verify(cv, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.Error) != 1 || sc.Error[0] != ErrPin {
+		t.Errorf("mismatch: got errors %v, want %v", sc.Error, ErrPin)
+	}
+	if sc.ReturnPin != spki {
+		t.Errorf("mismatch: got pin %q, want %q", sc.ReturnPin, spki)
+	}
+
+	sc = &ServerCheck{Options: Options{Pins: []string{spkiPin(root.Cert)}, PinType: PinIssuer}}
+	if err := sc.verify(cv, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sc.Error != nil {
+		t.Errorf("issuer: got errors %v", sc.Error)
+	}
+}
+
+func TestParseServerLinePins(t *testing.T) {
+	sc, err := ParseServerLine("example.com:443:tls:10d:pin=sha256/AAAA=:pin=BBBB=:pintype=Issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.Options.Pins) != 2 || sc.Options.Pins[0] != "sha256/AAAA=" || sc.Options.Pins[1] != "BBBB=" {
+		t.Errorf("got pins %q", sc.Options.Pins)
+	}
+	if sc.Options.PinType != PinIssuer {
+		t.Errorf("got pin type %q", sc.Options.PinType)
+	}
+	for _, l := range []string{
+		"example.com:443:tls:10d:pin=",
+		"example.com:443:tls:10d:pin=AAAA=:pintype=key",
+	} {
+		if _, err := ParseServerLine(l); err == nil {
+			t.Errorf("%s: no error", l)
+		}
+	}
+}
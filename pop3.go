@@ -0,0 +1,74 @@
+package certexpire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// readPOP3 reads a single line reply. Its code is +OK or -ERR.
+func readPOP3(r *LineReader) (*textReply, error) {
+	rep, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(rep.lines[0], "+OK"):
+		rep.code = "+OK"
+	case strings.HasPrefix(rep.lines[0], "-ERR"):
+		rep.code = "-ERR"
+	}
+	return rep, nil
+}
+
+// readPOP3List reads a reply that is followed by a dot terminated list on success, like the one to CAPA.
+func readPOP3List(r *LineReader) (*textReply, error) {
+	rep, err := readPOP3(r)
+	if err != nil {
+		return nil, err
+	}
+	if rep.code != "+OK" {
+		return rep, nil
+	}
+	return readDotList(r, rep)
+}
+
+// pop3OK fails unless the reply is +OK. For -ERR the error contains the server's text.
+func pop3OK(rep *textReply) error {
+	switch rep.code {
+	case "+OK":
+		return nil
+	case "-ERR":
+		return errors.New("certexpire: pop3 error: " + strings.TrimSpace(rep.lines[0][4:]))
+	default:
+		return ErrProtocol
+	}
+}
+
+var pop3Script = []textStep{
+	{read: readPOP3, expect: []textCheck{pop3OK}},
+	{send: "CAPA\r\n", read: readPOP3List, expect: []textCheck{pop3OK, expectCapability(hasWord("STLS"))}},
+	{send: "STLS\r\n", read: readPOP3, expect: []textCheck{pop3OK}},
+}
+
+func pop3prelude(conn net.Conn) error {
+	return runTextScript(conn, pop3Script)
+}
+
+// GetCertPOP3 returns the expiration date of a POP3 STLS cert.
+func GetCertPOP3(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertPOP3Context(ctx, servername, port, proxy)
+}
+
+// GetCertPOP3Context is like GetCertPOP3, but the retrieval is aborted when ctx is done.
+func GetCertPOP3Context(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), pop3prelude)
+}
+
+func init() {
+	RegisterProtocol("pop3", preludeFetcher(pop3prelude))
+}
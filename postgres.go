@@ -0,0 +1,46 @@
+package certexpire
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// postgresSSLRequest is the SSLRequest message: length 8, request code 80877103.
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+func postgresprelude(conn net.Conn) error {
+	_, err := conn.Write(postgresSSLRequest)
+	if err != nil {
+		return err
+	}
+	r := make([]byte, 1)
+	if _, err := io.ReadFull(conn, r); err != nil {
+		return err
+	}
+	switch r[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return ErrNoTLS
+	default:
+		return ErrProtocol
+	}
+}
+
+// GetCertPostgres returns the expiration date of a PostgreSQL server cert.
+func GetCertPostgres(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertPostgresContext(ctx, servername, port, proxy)
+}
+
+// GetCertPostgresContext is like GetCertPostgres, but the retrieval is aborted when ctx is done.
+func GetCertPostgresContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), postgresprelude)
+}
+
+func init() {
+	RegisterProtocol("postgres", preludeFetcher(postgresprelude))
+}
@@ -0,0 +1,47 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// postgresServer answers the SSLRequest with reply. For 'S', the TLS handshake follows with cert.
+func postgresServer(t *testing.T, reply byte, cert *testCert) string {
+	return fakeServer(t, func(conn net.Conn) {
+		req := make([]byte, len(postgresSSLRequest))
+		if _, err := io.ReadFull(conn, req); err != nil || !bytes.Equal(req, postgresSSLRequest) {
+			return
+		}
+		if _, err := conn.Write([]byte{reply}); err != nil {
+			return
+		}
+		if reply == 'S' {
+			serveTLS(conn, cert.TLS())
+		}
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cv, err := GetCertPostgresContext(ctx, "localhost", postgresServer(t, 'S', cert), nil)
+	if err != nil {
+		t.Fatalf("reply S: %s", err)
+	}
+	if !cv.Certificate.Equal(cert.Cert) {
+		t.Error("reply S: wrong certificate")
+	}
+	if _, err := GetCertPostgresContext(ctx, "localhost", postgresServer(t, 'N', cert), nil); !errors.Is(err, ErrNoTLS) {
+		t.Errorf("reply N: got error %v, want %v", err, ErrNoTLS)
+	}
+	if _, err := GetCertPostgresContext(ctx, "localhost", postgresServer(t, 'E', cert), nil); !errors.Is(err, ErrProtocol) {
+		t.Errorf("reply E: got error %v, want %v", err, ErrProtocol)
+	}
+}
@@ -0,0 +1,315 @@
+package certexpire
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options modify how the certificate of a check is retrieved and verified.
+type Options struct {
+	Addr  string // Connect to this host instead of Hostname. May include a port, which overrides Param. IPv6 literals in brackets.
+	SNI   string // Server name sent in the TLS handshake and verified in the certificate. Defaults to Hostname.
+	NoSNI bool   // Send no server name in the TLS handshake, to see the default certificate.
+
+	AllAddrs bool // Check every address the host resolves to, with one result per address.
+
+	Shell bool     // Run the command of the command protocol with sh -c instead of splitting it into arguments.
+	Env   []string // Additional environment of the command, NAME=value.
+	Exec  bool     // For the k8s-secret protocol, Param is a command whose output is read instead of a file.
+
+	LeafByName bool // In certificate files, the leaf is the certificate valid for Hostname instead of the first one.
+
+	Format       string // Format of certificate files and command output, one of the Format constants.
+	PasswordEnv  string // Environment variable containing the password of PKCS#12 files.
+	PasswordFile string // File containing the password of PKCS#12 files.
+
+	CAFile string // CA bundle to verify network certificates with, see Trust.
+	Trust  string // How the certificates of CAFile are used, one of the Trust constants.
+
+	Pins    []string // Any of these pins must match the certificate.
+	PinType string   // What the pins are compared with, one of the Pin constants. Defaults to PinSPKI.
+
+	OCSP         string        // Revocation check of network certificates, one of the OCSP mode constants.
+	OCSPDeadline time.Duration // Warning duration before a stapled OCSP response expires. Defaults to OCSPStapleDeadline.
+}
+
+// Set sets the option key to value, as given in a check line (key=value).
+func (o *Options) Set(key, value string) error {
+	switch key {
+	case "addr":
+		o.Addr = strings.ToLower(value)
+	case "sni":
+		o.SNI = strings.ToLower(value)
+		o.NoSNI = value == ""
+	case "addrs":
+		switch strings.ToLower(value) {
+		case "all":
+			o.AllAddrs = true
+		case "one":
+			o.AllAddrs = false
+		default:
+			return fmt.Errorf("bad value for option %q", key)
+		}
+	case "shell":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("bad value for option %q", key)
+		}
+		o.Shell = b
+	case "exec":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("bad value for option %q", key)
+		}
+		o.Exec = b
+	case "env":
+		if strings.IndexByte(value, '=') <= 0 {
+			return fmt.Errorf("bad value for option %q", key)
+		}
+		o.Env = append(o.Env, value)
+	case "leaf":
+		switch strings.ToLower(value) {
+		case "hostname":
+			o.LeafByName = true
+		case "first":
+			o.LeafByName = false
+		default:
+			return fmt.Errorf("bad value for option %q", key)
+		}
+	case "format":
+		f, ok := formatNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("bad value for option %q", key)
+		}
+		o.Format = f
+	case "password-env":
+		o.PasswordEnv = value
+	case "password-file":
+		o.PasswordFile = value
+	case "ca":
+		o.CAFile = value
+	case "trust":
+		switch t := strings.ToLower(value); t {
+		case TrustSystem, TrustAppend, TrustReplace, TrustNone:
+			o.Trust = t
+		default:
+			return fmt.Errorf("bad value for option %q", key)
+		}
+	case "pin":
+		if value == "" {
+			return fmt.Errorf("bad value for option %q", key)
+		}
+		o.Pins = append(o.Pins, value)
+	case "pintype":
+		switch t := strings.ToLower(value); t {
+		case PinSPKI, PinIssuer, PinCert:
+			o.PinType = t
+		default:
+			return fmt.Errorf("bad value for option %q", key)
+		}
+	case "ocsp":
+		switch m := strings.ToLower(value); m {
+		case "off":
+			o.OCSP = OCSPOff
+		case OCSPOn, OCSPStaple:
+			o.OCSP = m
+		default:
+			return fmt.Errorf("bad value for option %q", key)
+		}
+	case "ocspdeadline":
+		d, err := ParseDuration(strings.ToLower(value))
+		if err != nil {
+			return fmt.Errorf("bad value for option %q", key)
+		}
+		o.OCSPDeadline = d
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Target describes a certificate to retrieve.
+type Target struct {
+	Hostname string // Hostname for connect and certificate ownership.
+	Param    string // The parameter. Depends on protocol.
+	Protocol string // The protocol (tls, imap, etc).
+	Proxy    *Proxy // SOCKS5 proxy to connect through, if any.
+	Options  Options
+}
+
+func newTarget(servername, port string, proxy *Proxy) *Target {
+	return &Target{
+		Hostname: servername,
+		Param:    port,
+		Proxy:    proxy,
+	}
+}
+
+func (t *Target) cacheKey() string {
+	return fmt.Sprintf("%s:%s/%s/%+v", t.Hostname, t.Param, t.Protocol, t.Options)
+}
+
+// DialAddr returns the network address to connect to, honoring the addr option. Param is the port.
+func (t *Target) DialAddr() string {
+	if t.Options.Addr == "" {
+		return net.JoinHostPort(t.Hostname, t.Param)
+	}
+	if _, _, err := net.SplitHostPort(t.Options.Addr); err == nil {
+		return t.Options.Addr
+	}
+	return net.JoinHostPort(unbracket(t.Options.Addr), t.Param)
+}
+
+// verifyName returns the name the certificate must be valid for.
+func (t *Target) verifyName() string {
+	if t.Options.SNI != "" {
+		return t.Options.SNI
+	}
+	return t.Hostname
+}
+
+// serverName returns the server name to send in the TLS handshake.
+func (t *Target) serverName() string {
+	if t.Options.NoSNI {
+		return ""
+	}
+	return t.verifyName()
+}
+
+// Fetcher retrieves the certificate of a target.
+type Fetcher interface {
+	Fetch(ctx context.Context, t *Target) (*CertValues, error)
+}
+
+// FetcherFunc allows the use of ordinary functions as Fetcher.
+type FetcherFunc func(ctx context.Context, t *Target) (*CertValues, error)
+
+// Fetch calls f(ctx, t).
+func (f FetcherFunc) Fetch(ctx context.Context, t *Target) (*CertValues, error) {
+	return f(ctx, t)
+}
+
+// MultiFetcher is implemented by Fetchers that return several results for one check, e.g. one per keystore entry.
+type MultiFetcher interface {
+	Fetcher
+	FetchAll(ctx context.Context, t *Target) []FetchResult
+}
+
+// MultiFetcherFunc allows the use of ordinary functions as MultiFetcher.
+type MultiFetcherFunc func(ctx context.Context, t *Target) []FetchResult
+
+// Fetch returns the first result of f(ctx, t).
+func (f MultiFetcherFunc) Fetch(ctx context.Context, t *Target) (*CertValues, error) {
+	r := f(ctx, t)
+	if len(r) == 0 {
+		return nil, ErrNoCert
+	}
+	return r[0].Values, r[0].Err
+}
+
+// FetchAll calls f(ctx, t).
+func (f MultiFetcherFunc) FetchAll(ctx context.Context, t *Target) []FetchResult {
+	return f(ctx, t)
+}
+
+var (
+	protocolLock sync.RWMutex
+	protocols    = make(map[string]Fetcher)
+)
+
+// localProtocols read certificates from files or commands instead of connecting to the host, so they cannot
+// be checked on each address.
+var localProtocols = map[string]bool{
+	"file":       true,
+	"command":    true,
+	"dir":        true,
+	"jks":        true,
+	"certbot":    true,
+	"k8s-secret": true,
+}
+
+// RegisterProtocol makes a Fetcher available under name, both for GetCert and in check configuration files.
+// Registering a name again replaces the previous Fetcher.
+func RegisterProtocol(name string, f Fetcher) {
+	protocolLock.Lock()
+	defer protocolLock.Unlock()
+	protocols[cleanline(name)] = f
+}
+
+// LookupProtocol returns the Fetcher registered for name.
+func LookupProtocol(name string) (Fetcher, bool) {
+	protocolLock.RLock()
+	defer protocolLock.RUnlock()
+	f, ok := protocols[cleanline(name)]
+	return f, ok
+}
+
+// Protocols returns the sorted names of all registered protocols.
+func Protocols() []string {
+	protocolLock.RLock()
+	defer protocolLock.RUnlock()
+	r := make([]string, 0, len(protocols))
+	for k := range protocols {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// lookupFetcher returns the Fetcher registered for t.Protocol. An empty protocol means tls.
+func lookupFetcher(t *Target) (Fetcher, error) {
+	proto := t.Protocol
+	if proto == "" {
+		proto = "tls"
+	}
+	f, ok := LookupProtocol(proto)
+	if !ok {
+		return nil, ErrConfig
+	}
+	return f, nil
+}
+
+// FetchCert retrieves the certificate of t with the Fetcher registered for t.Protocol. An empty protocol means tls.
+func FetchCert(ctx context.Context, t *Target) (*CertValues, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := lookupFetcher(t)
+	if err != nil {
+		return nil, err
+	}
+	return f.Fetch(ctx, t)
+}
+
+// FetchResult is one of several results of a check.
+type FetchResult struct {
+	Name   string // Source of the result, e.g. the address. Empty for checks with a single result.
+	Param  string // Replaces the param of the check in reports if set, e.g. with the path of the file.
+	Values *CertValues
+	Err    error
+}
+
+// FetchCerts retrieves the certificates of t. If t.Options.AllAddrs is set, the certificate is retrieved from
+// each address the host resolves to, one result per address. Protocols registered as MultiFetcher return their
+// results. Otherwise the single result of FetchCert is returned.
+func FetchCerts(ctx context.Context, t *Target) []FetchResult {
+	if t.Options.AllAddrs {
+		return fetchAllAddrs(ctx, t)
+	}
+	if f, err := lookupFetcher(t); err == nil {
+		if m, ok := f.(MultiFetcher); ok && ctx.Err() == nil {
+			if r := m.FetchAll(ctx, t); len(r) > 0 {
+				return r
+			}
+			return []FetchResult{{Err: ErrNoCert}}
+		}
+	}
+	cv, err := FetchCert(ctx, t)
+	return []FetchResult{{Values: cv, Err: err}}
+}
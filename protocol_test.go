@@ -0,0 +1,62 @@
+package certexpire
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+// sniServer serves cert and sends the server name the client asked for to sni.
+func sniServer(t *testing.T, cert *testCert, sni chan<- string) string {
+	return fakeServer(t, func(conn net.Conn) {
+		_ = tls.Server(conn, &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				sni <- hello.ServerName
+				c := cert.TLS()
+				return &c, nil
+			},
+		}).Handshake()
+	})
+}
+
+func TestTargetSNI(t *testing.T) {
+	cert := newTestCert(t, "www.example.test", time.Now().Add(24*time.Hour), nil)
+	tests := []struct {
+		name     string
+		hostname string
+		options  Options
+		sni      string
+		verifyOK bool
+	}{
+		// The host names of .test do not resolve, addr makes the check connect anyway.
+		{"addr", "www.example.test", Options{Addr: "127.0.0.1"}, "www.example.test", true},
+		{"sni", "localhost", Options{SNI: "www.example.test"}, "www.example.test", true},
+		{"sni-mismatch", "localhost", Options{SNI: "other.example.test"}, "other.example.test", false},
+		{"no-sni", "localhost", Options{NoSNI: true}, "", false},
+		{"no-sni-addr", "www.example.test", Options{NoSNI: true, Addr: "127.0.0.1"}, "", true},
+	}
+	for _, test := range tests {
+		sni := make(chan string, 1)
+		test.options.Trust = TrustNone
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cv, err := FetchCert(ctx, &Target{
+			Hostname: test.hostname,
+			Param:    sniServer(t, cert, sni),
+			Protocol: "tls",
+			Options:  test.options,
+		})
+		cancel()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if s := <-sni; s != test.sni {
+			t.Errorf("%s: server got name %q, want %q", test.name, s, test.sni)
+		}
+		if (cv.VerifyError == nil) != test.verifyOK {
+			t.Errorf("%s: got verify error %v", test.name, cv.VerifyError)
+		}
+	}
+}
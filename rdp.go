@@ -0,0 +1,107 @@
+package certexpire
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Negotiation failures reported by RDP servers.
+var (
+	ErrRDPSSLRequired             = errors.New("certexpire: rdp: SSL required by server")
+	ErrRDPSSLNotAllowed           = errors.New("certexpire: rdp: SSL not allowed by server")
+	ErrRDPSSLCertNotOnServer      = errors.New("certexpire: rdp: SSL certificate not on server")
+	ErrRDPInconsistentFlags       = errors.New("certexpire: rdp: inconsistent flags")
+	ErrRDPHybridRequired          = errors.New("certexpire: rdp: hybrid required by server")
+	ErrRDPSSLWithUserAuthRequired = errors.New("certexpire: rdp: SSL with user authentication required by server")
+)
+
+var rdpFailures = map[uint32]error{
+	1: ErrRDPSSLRequired,
+	2: ErrRDPSSLNotAllowed,
+	3: ErrRDPSSLCertNotOnServer,
+	4: ErrRDPInconsistentFlags,
+	5: ErrRDPHybridRequired,
+	6: ErrRDPSSLWithUserAuthRequired,
+}
+
+const (
+	rdpTypeNegRsp     = 0x02
+	rdpTypeNegFailure = 0x03
+	rdpProtocolRDP    = 0x00000000
+)
+
+// rdpConnectionRequest is a TPKT framed X.224 Connection Request with an RDP Negotiation Request
+// for PROTOCOL_SSL and PROTOCOL_HYBRID.
+var rdpConnectionRequest = []byte{
+	0x03, 0x00, 0x00, 0x13, // TPKT, length 19
+	0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, // X.224 CR TPDU
+	0x01, 0x00, 0x08, 0x00, 0x03, 0x00, 0x00, 0x00, // RDP_NEG_REQ, PROTOCOL_SSL|PROTOCOL_HYBRID
+}
+
+// rdpNegotiation parses the X.224 Connection Confirm in p and returns an error unless TLS was selected.
+func rdpNegotiation(p []byte) error {
+	if len(p) < 7 || p[1] != 0xd0 {
+		return ErrProtocol
+	}
+	neg := p[7:]
+	if len(neg) < 8 {
+		// No negotiation response: the server only speaks standard RDP security.
+		return ErrNoTLS
+	}
+	v := binary.LittleEndian.Uint32(neg[4:8])
+	switch neg[0] {
+	case rdpTypeNegRsp:
+		if v == rdpProtocolRDP {
+			return ErrNoTLS
+		}
+		return nil
+	case rdpTypeNegFailure:
+		if err, ok := rdpFailures[v]; ok {
+			return err
+		}
+		return fmt.Errorf("certexpire: rdp: negotiation failure %d", v)
+	default:
+		return ErrProtocol
+	}
+}
+
+func rdpprelude(conn net.Conn) error {
+	_, err := conn.Write(rdpConnectionRequest)
+	if err != nil {
+		return err
+	}
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(conn, h); err != nil {
+		return err
+	}
+	l := int(binary.BigEndian.Uint16(h[2:4]))
+	if h[0] != 0x03 || l < 4 || l > 1024 {
+		return ErrProtocol
+	}
+	p := make([]byte, l-4)
+	if _, err := io.ReadFull(conn, p); err != nil {
+		return err
+	}
+	return rdpNegotiation(p)
+}
+
+// GetCertRDP returns the expiration date of an RDP server cert.
+func GetCertRDP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertRDPContext(ctx, servername, port, proxy)
+}
+
+// GetCertRDPContext is like GetCertRDP, but the retrieval is aborted when ctx is done.
+func GetCertRDPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), rdpprelude)
+}
+
+func init() {
+	RegisterProtocol("rdp", preludeFetcher(rdpprelude))
+}
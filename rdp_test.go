@@ -0,0 +1,77 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// rdpConfirm returns an X.224 Connection Confirm with a negotiation message of type typ and value v.
+func rdpConfirm(typ byte, v uint32) []byte {
+	return []byte{
+		0x0e, 0xd0, 0x00, 0x00, 0x12, 0x34, 0x00,
+		typ, 0x00, 0x08, 0x00, byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24),
+	}
+}
+
+func TestRDPNegotiation(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"ssl", rdpConfirm(rdpTypeNegRsp, 1), nil},
+		{"hybrid", rdpConfirm(rdpTypeNegRsp, 2), nil},
+		{"standard-rdp", rdpConfirm(rdpTypeNegRsp, rdpProtocolRDP), ErrNoTLS},
+		{"no-negotiation", rdpConfirm(rdpTypeNegRsp, 1)[:7], ErrNoTLS},
+		{"ssl-not-allowed", rdpConfirm(rdpTypeNegFailure, 2), ErrRDPSSLNotAllowed},
+		{"hybrid-required", rdpConfirm(rdpTypeNegFailure, 5), ErrRDPHybridRequired},
+		{"unknown-type", rdpConfirm(0x01, 1), ErrProtocol},
+		{"not-confirm", append([]byte{0x0e, 0xe0}, rdpConfirm(rdpTypeNegRsp, 1)[2:]...), ErrProtocol},
+		{"short", []byte{0x0e, 0xd0, 0x00}, ErrProtocol},
+	}
+	for _, test := range tests {
+		if err := rdpNegotiation(test.data); err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+	if err := rdpNegotiation(rdpConfirm(rdpTypeNegFailure, 99)); err == nil {
+		t.Error("unknown failure: no error")
+	}
+}
+
+// rdpServer answers the Connection Request with the Connection Confirm cc. The TLS handshake with cert follows.
+func rdpServer(t *testing.T, cc []byte, cert *testCert) string {
+	return fakeServer(t, func(conn net.Conn) {
+		req := make([]byte, len(rdpConnectionRequest))
+		if _, err := io.ReadFull(conn, req); err != nil || !bytes.Equal(req, rdpConnectionRequest) {
+			return
+		}
+		if _, err := conn.Write(append([]byte{0x03, 0x00, 0x00, byte(4 + len(cc))}, cc...)); err != nil {
+			return
+		}
+		serveTLS(conn, cert.TLS())
+	})
+}
+
+func TestRDP(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cv, err := GetCertRDPContext(ctx, "localhost", rdpServer(t, rdpConfirm(rdpTypeNegRsp, 1), cert), nil)
+	if err != nil {
+		t.Fatalf("ssl: %s", err)
+	}
+	if cv.Certificate == nil || !cv.Certificate.Equal(cert.Cert) {
+		t.Error("ssl: wrong certificate")
+	}
+	_, err = GetCertRDPContext(ctx, "localhost", rdpServer(t, rdpConfirm(rdpTypeNegFailure, 1), cert), nil)
+	if !errors.Is(err, ErrRDPSSLRequired) {
+		t.Errorf("failure: got error %v, want %v", err, ErrRDPSSLRequired)
+	}
+}
@@ -1,6 +1,8 @@
 package certexpire
 
 import (
+	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,7 +16,8 @@ type Report struct {
 	Logger       *Logger
 	MailTemplate []byte
 
-	cache *Cache
+	cache     *Cache
+	cacheOnce sync.Once
 
 	MailHostname string
 	MailPort     string
@@ -23,7 +26,13 @@ type Report struct {
 	MailPassword string
 }
 
+// Generate runs all checks of config and sends the reports.
 func (rep *Report) Generate(config *Config) {
+	rep.GenerateContext(context.Background(), config)
+}
+
+// GenerateContext is like Generate, but the run is aborted when ctx is done. Reports are not sent for aborted runs.
+func (rep *Report) GenerateContext(ctx context.Context, config *Config) {
 	if config.Mail != nil {
 		rep.MailHostname = config.Mail.Hostname
 		rep.MailPort = config.Mail.Port
@@ -32,32 +41,38 @@ func (rep *Report) Generate(config *Config) {
 		rep.MailPassword = config.Mail.Password
 	}
 
-	if rep.cache == nil {
-		rep.cache = NewCache()
-	}
 	mailRoutines := new(sync.WaitGroup)
 	endChan := make(chan interface{}, 1)
 	resultChan := make(chan interface{}, rep.Workers)
 	pool := workerpool.New(rep.Workers)
 	go func() {
 		for m := range resultChan {
-			switch e := m.(type) {
+			switch m := m.(type) {
 			case bool:
 				close(endChan)
 				return
-			case *ServerCheck:
+			case []*ServerCheck:
+				// The first result takes the place of the check, further results are added to the entry.
+				e := m[0]
 				config.Tests[e.KeyS].NumChecks--
-				config.Tests[e.KeyS].Checks[e.KeyC] = *e
-				if e.Error != nil || e.ExecuteError != nil {
-					config.Tests[e.KeyS].Alert = true
-					rep.LogError(e)
-					if e.ExecuteError != nil {
-						rep.Error(e.ExecuteError.Error())
+				for i, x := range m {
+					if i == 0 {
+						config.Tests[e.KeyS].Checks[e.KeyC] = *x
+					} else {
+						config.Tests[e.KeyS].Checks = append(config.Tests[e.KeyS].Checks, *x)
+					}
+					if x.Error != nil || x.ExecuteError != nil {
+						config.Tests[e.KeyS].Alert = true
+						rep.LogError(x)
+						if x.ExecuteError != nil {
+							rep.Error(x.ExecuteError.Error())
+						}
+					} else {
+						rep.LogStatus(x)
 					}
-				} else {
-					rep.LogStatus(e)
 				}
-				if config.Mail != nil &&
+				if ctx.Err() == nil &&
+					config.Mail != nil &&
 					config.Tests[e.KeyS].Alert &&
 					config.Tests[e.KeyS].MailTo != "" &&
 					config.Tests[e.KeyS].NumChecks <= 0 {
@@ -75,8 +90,9 @@ func (rep *Report) Generate(config *Config) {
 		for _, c := range e.Checks {
 			x := c.Copy()
 			pool.Submit(func() {
-				rep.VerifyCert(&x, rep.Timeout)
-				resultChan <- &x
+				checkCtx, cancel := context.WithTimeout(ctx, rep.Timeout)
+				defer cancel()
+				resultChan <- rep.VerifyCerts(checkCtx, &x)
 			})
 		}
 	}
@@ -87,36 +103,110 @@ func (rep *Report) Generate(config *Config) {
 }
 
 type getCertResult struct {
-	certValues *CertValues
-	err        error
+	results []FetchResult
+	aborted bool // The context of the retrieval was done, the results are not cached.
 }
 
-func getCertFuture(servername, port, proto string, timeout time.Duration, proxy *Proxy) *getCertResult {
-	r := &getCertResult{}
-	r.certValues, r.err = GetCert(servername, port, proto, timeout, proxy)
-	return r
+// Transient returns true for aborted retrievals.
+func (r *getCertResult) Transient() bool {
+	return r.aborted
 }
 
-func getCertCacheKey(servername, port, proto string) string {
-	return servername + ":" + port + "/" + proto
+func getCertFuture(ctx context.Context, t *Target) *getCertResult {
+	r := &getCertResult{results: FetchCerts(ctx, t)}
+	r.aborted = ctx.Err() != nil
+	return r
 }
 
 func (rep *Report) GetCert(servername, port, proto string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
-	c := rep.cache.Lookup(getCertCacheKey(servername, port, proto), func() interface{} { return getCertFuture(servername, port, proto, timeout, proxy) })
-	r := <-c
-	rt := r.(*getCertResult)
-	return rt.certValues, rt.err
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return rep.GetCertContext(ctx, servername, port, proto, proxy)
 }
 
-func (rep *Report) VerifyCert(sc *ServerCheck, timeout time.Duration) error {
-	var cv *CertValues
-	var err error
-	sc.Error = make([]error, 0, 1)
+// GetCertContext is like GetCert, but waiting for the result is aborted when ctx is done.
+func (rep *Report) GetCertContext(ctx context.Context, servername, port, proto string, proxy *Proxy) (*CertValues, error) {
+	return rep.FetchCert(ctx, &Target{
+		Hostname: servername,
+		Param:    port,
+		Protocol: proto,
+		Proxy:    proxy,
+	})
+}
+
+// FetchCert retrieves the certificate of t through the cache. For targets with several results, the first is returned.
+func (rep *Report) FetchCert(ctx context.Context, t *Target) (*CertValues, error) {
+	r := rep.FetchCerts(ctx, t)
+	return r[0].Values, r[0].Err
+}
+
+// FetchCerts is like the package level FetchCerts, but retrieves through the cache.
+// Retrievals aborted by their context are not cached.
+func (rep *Report) FetchCerts(ctx context.Context, t *Target) []FetchResult {
+	rep.cacheOnce.Do(func() {
+		if rep.cache == nil {
+			rep.cache = NewCache()
+		}
+	})
+	for {
+		c := rep.cache.Lookup(t.cacheKey(), func() interface{} { return getCertFuture(ctx, t) })
+		select {
+		case v := <-c:
+			r := v.(*getCertResult)
+			if r.aborted && ctx.Err() == nil {
+				// Aborted by the context of another caller, retry with ours.
+				continue
+			}
+			return r.results
+		case <-ctx.Done():
+			return []FetchResult{{Err: ctx.Err()}}
+		}
+	}
+}
+
+func (rep *Report) fetchCerts(ctx context.Context, t *Target) []FetchResult {
 	if rep.UseCache {
-		cv, err = rep.GetCert(sc.Hostname, sc.Param, sc.Protocol, timeout, sc.Proxy)
-	} else {
-		cv, err = GetCert(sc.Hostname, sc.Param, sc.Protocol, timeout, sc.Proxy)
+		return rep.FetchCerts(ctx, t)
 	}
+	return FetchCerts(ctx, t)
+}
+
+func (rep *Report) VerifyCert(sc *ServerCheck, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return rep.VerifyCertContext(ctx, sc)
+}
+
+// VerifyCertContext is like VerifyCert, but the check is aborted when ctx is done.
+// For checks with several results, only the first is verified. Use VerifyCerts for those.
+func (rep *Report) VerifyCertContext(ctx context.Context, sc *ServerCheck) error {
+	r := rep.fetchCerts(ctx, sc.Target())
+	sc.Source = r[0].Name
+	return sc.verify(r[0].Values, r[0].Err)
+}
+
+// VerifyCerts runs the check sc and returns one verified copy of sc per result.
+func (rep *Report) VerifyCerts(ctx context.Context, sc *ServerCheck) []*ServerCheck {
+	r := rep.fetchCerts(ctx, sc.Target())
+	checks := make([]*ServerCheck, len(r))
+	for i, res := range r {
+		x := sc.Copy()
+		x.Source = res.Name
+		if res.Param != "" {
+			x.Param = res.Param
+		}
+		_ = x.verify(res.Values, res.Err)
+		checks[i] = &x
+	}
+	if sc.Options.AllAddrs {
+		markMismatch(checks)
+	}
+	return checks
+}
+
+// verify applies the check to the retrieved certificate.
+func (sc *ServerCheck) verify(cv *CertValues, err error) error {
+	sc.Error = make([]error, 0, 1)
 	if err != nil {
 		sc.ExecuteError = err
 		return err
@@ -125,11 +215,30 @@ func (rep *Report) VerifyCert(sc *ServerCheck, timeout time.Duration) error {
 	if cv.VerifyError != nil {
 		sc.Error = append(sc.Error, cv.VerifyError)
 	}
+	sc.Error = append(sc.Error, cv.OCSPErrors...)
 	sc.ReturnHash = cv.Hash
 	if sc.Hash != "" && cv.Hash != sc.Hash {
 		sc.Error = append(sc.Error, ErrHash)
 	}
-	if time.Now().Add(sc.Deadline).After(cv.Expire) {
+	if len(sc.Options.Pins) > 0 {
+		ok, values := matchPins(cv, sc.Options.Pins, sc.Options.PinType)
+		sc.ReturnPin = strings.Join(values, " ")
+		if !ok {
+			sc.Error = append(sc.Error, ErrPin)
+		}
+	}
+	deadline := time.Now().Add(sc.Deadline)
+	if len(cv.Chain) > 0 {
+		// Each certificate is checked, ExpireTime is the earliest expiry.
+		for i, c := range cv.Chain {
+			if c.NotAfter.Before(sc.ExpireTime) {
+				sc.ExpireTime = c.NotAfter
+			}
+			if deadline.After(c.NotAfter) {
+				sc.Error = append(sc.Error, &ExpireError{Position: i + 1, Subject: c.Subject.String(), Expire: c.NotAfter})
+			}
+		}
+	} else if deadline.After(cv.Expire) {
 		sc.Error = append(sc.Error, ErrExpire)
 	}
 	if len(sc.Error) == 0 {
@@ -137,3 +246,33 @@ func (rep *Report) VerifyCert(sc *ServerCheck, timeout time.Duration) error {
 	}
 	return nil
 }
+
+// markMismatch adds ErrMismatch to the checks whose certificate differs from the one most checks returned.
+// Without a strict majority there is no certificate to compare with, and every check is marked.
+func markMismatch(checks []*ServerCheck) {
+	count := make(map[string]int)
+	var common string
+	var n int
+	for _, c := range checks {
+		if c.ExecuteError != nil {
+			continue
+		}
+		n++
+		k := c.ReturnHash + c.ExpireTime.String()
+		count[k]++
+		if count[k] > count[common] {
+			common = k
+		}
+	}
+	if len(count) < 2 {
+		return
+	}
+	if count[common]*2 <= n {
+		common = ""
+	}
+	for _, c := range checks {
+		if c.ExecuteError == nil && (common == "" || c.ReturnHash+c.ExpireTime.String() != common) {
+			c.Error = append(c.Error, ErrMismatch)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package certexpire
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReportFetchCertsAborted(t *testing.T) {
+	var calls int32
+	RegisterProtocol("test-abort", FetcherFunc(func(ctx context.Context, t *Target) (*CertValues, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &CertValues{Hostname: t.Hostname}, nil
+	}))
+	rep := new(Report)
+	target := &Target{Hostname: "example.com", Protocol: "test-abort"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := rep.FetchCert(ctx, target); err != context.DeadlineExceeded {
+		t.Fatalf("first fetch: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	cv, err := rep.FetchCert(context.Background(), target)
+	if err != nil || cv == nil {
+		t.Fatalf("second fetch: got error %v", err)
+	}
+	if _, err := rep.FetchCert(context.Background(), target); err != nil {
+		t.Fatalf("cached fetch: got error %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("fetcher called %d times, want 2", n)
+	}
+}
+
+func TestMarkMismatch(t *testing.T) {
+	failed := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		hashes   []string // An empty hash is a check that failed to execute.
+		mismatch []bool
+	}{
+		{"same", []string{"a", "a", "a"}, []bool{false, false, false}},
+		{"majority", []string{"a", "b", "a"}, []bool{false, true, false}},
+		{"tie", []string{"a", "b"}, []bool{true, true}},
+		{"tie-2-2", []string{"a", "b", "b", "a"}, []bool{true, true, true, true}},
+		{"no-majority", []string{"a", "b", "c", "a"}, []bool{true, true, true, true}},
+		{"execute-error", []string{"a", "", "a"}, []bool{false, false, false}},
+		{"execute-error-tie", []string{"a", "", "b"}, []bool{true, false, true}},
+		{"execute-error-majority", []string{"", "a", "b", "b"}, []bool{false, true, false, false}},
+	}
+	expire := time.Now()
+	for _, test := range tests {
+		checks := make([]*ServerCheck, len(test.hashes))
+		for i, h := range test.hashes {
+			checks[i] = &ServerCheck{ReturnHash: h, ExpireTime: expire}
+			if h == "" {
+				checks[i].ExecuteError = failed
+			}
+		}
+		markMismatch(checks)
+		for i, c := range checks {
+			got := len(c.Error) == 1 && c.Error[0] == ErrMismatch
+			if got != test.mismatch[i] || (!got && len(c.Error) > 0) {
+				t.Errorf("%s: check %d got errors %v, want mismatch %t", test.name, i, c.Error, test.mismatch[i])
+			}
+		}
+	}
+}
+
+func TestReportFetchCertChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	leaf, inter, root := testChain(t, "localhost")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, root.PEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		served  tls.Certificate
+		options Options
+		chain   []*testCert
+	}{
+		{"served", leaf.TLS(inter), Options{Trust: TrustNone}, []*testCert{leaf, inter}},
+		{"verified", leaf.TLS(inter), Options{Trust: TrustReplace, CAFile: caFile}, []*testCert{leaf, inter, root}},
+		{"leaf-only", leaf.TLS(), Options{Trust: TrustNone}, nil},
+	}
+	for _, test := range tests {
+		served := test.served
+		port := fakeServer(t, func(conn net.Conn) { serveTLS(conn, served) })
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cv, err := new(Report).FetchCert(ctx, &Target{Hostname: "localhost", Param: port, Protocol: "tls", Options: test.options})
+		cancel()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if cv.VerifyError != nil {
+			t.Errorf("%s: verify error %s", test.name, cv.VerifyError)
+		}
+		if !sameCerts(cv.Chain, test.chain...) {
+			t.Errorf("%s: got chain of %d certificates, want %d in order", test.name, len(cv.Chain), len(test.chain))
+		}
+	}
+}
+
+func TestReportChainExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := newTestCert(t, "Test Root", time.Now().Add(90*24*time.Hour), nil)
+	inter := newTestCert(t, "Test Intermediate", time.Now().Add(5*24*time.Hour), root, asCA)
+	leaf := newTestCert(t, "localhost", time.Now().Add(60*24*time.Hour), inter)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, root.PEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	port := fakeServer(t, func(conn net.Conn) { serveTLS(conn, leaf.TLS(inter)) })
+
+	msgs := make(chan interface{}, 1)
+	rep := &Report{Logger: &Logger{msgChan: msgs}}
+	sc := &ServerCheck{
+		Hostname: "localhost",
+		Param:    port,
+		Protocol: "tls",
+		Deadline: 10 * 24 * time.Hour,
+		Options:  Options{Trust: TrustReplace, CAFile: caFile},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sc.verify(rep.FetchCert(ctx, sc.Target())); err != nil {
+		t.Fatal(err)
+	}
+	if !sc.ExpireTime.Equal(inter.Cert.NotAfter) {
+		t.Errorf("got expiry %s, want that of the intermediate %s", sc.ExpireTime, inter.Cert.NotAfter)
+	}
+	if len(sc.Error) != 1 {
+		t.Fatalf("got errors %v, want one", sc.Error)
+	}
+	e, ok := sc.Error[0].(*ExpireError)
+	if !ok {
+		t.Fatalf("got error %T %v, want *ExpireError", sc.Error[0], sc.Error[0])
+	}
+	if e.Position != 2 || e.Subject != "CN=Test Intermediate" || !e.Expire.Equal(inter.Cert.NotAfter) {
+		t.Errorf("got %+v", e)
+	}
+
+	rep.LogError(sc)
+	l := (<-msgs).(LogLine)
+	for _, want := range []string{
+		"localhost:" + port + ",",
+		"certificate 2 (CN=Test Intermediate) expires " + inter.Cert.NotAfter.Format("2006-01-02"),
+		",Expires=" + inter.Cert.NotAfter.Format("2006-01-02"),
+	} {
+		if l.MsgType != MsgLogError || !strings.Contains(l.Message, want) {
+			t.Errorf("log line %q lacks %q", l.Message, want)
+		}
+	}
+}
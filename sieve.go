@@ -0,0 +1,33 @@
+package certexpire
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// The server greets with its capabilities, one quoted name per line, followed by OK.
+var sieveScript = []textStep{
+	{read: readTagged, expect: []textCheck{expectCode("OK"), expectCapability(hasWord(`"STARTTLS"`))}},
+	{send: "STARTTLS\r\n", read: readTagged, expect: []textCheck{expectCode("OK")}},
+}
+
+func sieveprelude(conn net.Conn) error {
+	return runTextScript(conn, sieveScript)
+}
+
+// GetCertSieve returns the expiration date of a ManageSieve STARTTLS cert.
+func GetCertSieve(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertSieveContext(ctx, servername, port, proxy)
+}
+
+// GetCertSieveContext is like GetCertSieve, but the retrieval is aborted when ctx is done.
+func GetCertSieveContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), sieveprelude)
+}
+
+func init() {
+	RegisterProtocol("sieve", preludeFetcher(sieveprelude))
+}
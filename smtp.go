@@ -1,6 +1,7 @@
 package certexpire
 
 import (
+	"context"
 	"net"
 	"os"
 	"strings"
@@ -16,48 +17,52 @@ func smtpHasStartTLS(s []string) bool {
 	return false
 }
 
-func smtpprelude(conn net.Conn) error {
-	r := NewLineReader(conn)
-	c, _, err := r.ReadNumericContinuous()
-	if c != "220" {
-		return ErrProtocol
-	}
+// smtpScript negotiates STARTTLS for SMTP (greeting EHLO) and LMTP (greeting LHLO).
+func smtpScript(greeting string) []textStep {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "local"
 	}
-	_, err = conn.Write([]byte("EHLO " + hostname + "\r\n"))
-	if err != nil {
-		return err
-	}
-	c, m, err := r.ReadNumericContinuous()
-	if c != "250" {
-		return ErrProtocol
-	}
-	if !smtpHasStartTLS(m) {
-		return ErrProtocol
-	}
-	_, err = conn.Write([]byte("STARTTLS\r\n"))
-	if err != nil {
-		return err
-	}
-	c, _, err = r.ReadNumericContinuous()
-	if c != "220" {
-		return ErrProtocol
+	return []textStep{
+		{read: readNumeric, expect: []textCheck{expectCode("220")}},
+		{send: greeting + " " + hostname + "\r\n", read: readNumeric, expect: []textCheck{expectCode("250"), expectCapabilityErr(smtpHasStartTLS, ErrProtocol)}},
+		{send: "STARTTLS\r\n", read: readNumeric, expect: []textCheck{expectCode("220")}},
 	}
-	return nil
+}
+
+func smtpprelude(conn net.Conn) error {
+	return runTextScript(conn, smtpScript("EHLO"))
+}
+
+func lmtpprelude(conn net.Conn) error {
+	return runTextScript(conn, smtpScript("LHLO"))
 }
 
 // GetCertSMTP returns the expiration date of an SMTP STARTTLS cert.
 func GetCertSMTP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
-	conn, err := TCPDailer(servername+":"+port, proxy, timeout)
-	if err != nil {
-		return nil, err
-	}
-	conn.SetDeadline(deadline(timeout))
-	defer conn.Close()
-	if err := smtpprelude(conn); err != nil {
-		return nil, err
-	}
-	return GetCertificate(conn, servername, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertSMTPContext(ctx, servername, port, proxy)
+}
+
+// GetCertSMTPContext is like GetCertSMTP, but the retrieval is aborted when ctx is done.
+func GetCertSMTPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), smtpprelude)
+}
+
+// GetCertLMTP returns the expiration date of an LMTP STARTTLS cert.
+func GetCertLMTP(servername, port string, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertLMTPContext(ctx, servername, port, proxy)
+}
+
+// GetCertLMTPContext is like GetCertLMTP, but the retrieval is aborted when ctx is done.
+func GetCertLMTPContext(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error) {
+	return getCertPrelude(ctx, newTarget(servername, port, proxy), lmtpprelude)
+}
+
+func init() {
+	RegisterProtocol("smtp", preludeFetcher(smtpprelude))
+	RegisterProtocol("lmtp", preludeFetcher(lmtpprelude))
 }
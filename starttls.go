@@ -0,0 +1,175 @@
+package certexpire
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+// textReply is a reply of a line based protocol.
+type textReply struct {
+	code  string   // Status of the reply, e.g. 250, +OK or OK. Empty if the protocol has none.
+	lines []string // Lines of the reply.
+}
+
+// textCheck verifies a reply.
+type textCheck func(rep *textReply) error
+
+// textStep is one exchange of a line based STARTTLS negotiation.
+type textStep struct {
+	send   string                                  // Command to send before reading the reply. Empty for none.
+	read   func(r *LineReader) (*textReply, error) // Reads the reply.
+	expect []textCheck                             // Checks applied to the reply, in order.
+}
+
+// runTextScript runs the exchanges of a line based STARTTLS negotiation on conn.
+// After it returns without error, conn is ready for the TLS handshake.
+func runTextScript(conn net.Conn, script []textStep) error {
+	r := NewLineReader(conn)
+	for _, s := range script {
+		if s.send != "" {
+			if _, err := conn.Write([]byte(s.send)); err != nil {
+				return err
+			}
+		}
+		rep, err := s.read(r)
+		if err != nil {
+			return err
+		}
+		for _, e := range s.expect {
+			if err := e(rep); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readLine reads a single line reply.
+func readLine(r *LineReader) (*textReply, error) {
+	l, err := r.Line()
+	if err != nil {
+		return nil, err
+	}
+	return &textReply{lines: []string{string(l)}}, nil
+}
+
+// readNumeric reads a possibly multi-line reply with numeric code, as used by SMTP and FTP.
+func readNumeric(r *LineReader) (*textReply, error) {
+	c, m, err := r.ReadNumericContinuous()
+	if err != nil {
+		return nil, err
+	}
+	return &textReply{code: c, lines: m}, nil
+}
+
+// readDotList appends lines to rep until the terminating ".".
+func readDotList(r *LineReader, rep *textReply) (*textReply, error) {
+	for {
+		l, err := r.Line()
+		if err != nil {
+			return nil, err
+		}
+		if string(bytes.TrimSpace(l)) == "." {
+			return rep, nil
+		}
+		rep.lines = append(rep.lines, string(l))
+	}
+}
+
+// readStatusList reads a single line reply with numeric code. 1xx replies are followed by a dot terminated list (NNTP).
+func readStatusList(r *LineReader) (*textReply, error) {
+	c, m, _, err := r.ReadNumeric()
+	if err != nil {
+		return nil, err
+	}
+	rep := &textReply{code: c, lines: []string{m}}
+	if strings.HasPrefix(c, "1") {
+		return readDotList(r, rep)
+	}
+	return rep, nil
+}
+
+// readTagged reads lines until one starts with a status keyword: OK, NO or BYE (ManageSieve).
+func readTagged(r *LineReader) (*textReply, error) {
+	rep := &textReply{lines: make([]string, 0, 1)}
+	for {
+		l, err := r.Line()
+		if err != nil {
+			return nil, err
+		}
+		rep.lines = append(rep.lines, string(l))
+		f := strings.Fields(string(l))
+		if len(f) > 0 {
+			switch s := strings.ToUpper(f[0]); s {
+			case "OK", "NO", "BYE":
+				rep.code = s
+				return rep, nil
+			}
+		}
+	}
+}
+
+// expectCode fails with ErrProtocol unless the reply has one of codes.
+func expectCode(codes ...string) textCheck {
+	return func(rep *textReply) error {
+		for _, c := range codes {
+			if rep.code == c {
+				return nil
+			}
+		}
+		return ErrProtocol
+	}
+}
+
+// expectPrefix fails with ErrProtocol unless the first line of the reply starts with prefix.
+func expectPrefix(prefix string) textCheck {
+	return func(rep *textReply) error {
+		if len(rep.lines) == 0 || !strings.HasPrefix(rep.lines[0], prefix) {
+			return ErrProtocol
+		}
+		return nil
+	}
+}
+
+// expectContains fails with ErrProtocol unless a line of the reply contains s.
+func expectContains(s string) textCheck {
+	return func(rep *textReply) error {
+		for _, l := range rep.lines {
+			if strings.Contains(l, s) {
+				return nil
+			}
+		}
+		return ErrProtocol
+	}
+}
+
+// expectCapability fails with ErrNoTLS unless has reports STARTTLS support in the reply lines.
+func expectCapability(has func(lines []string) bool) textCheck {
+	return expectCapabilityErr(has, ErrNoTLS)
+}
+
+// expectCapabilityErr is like expectCapability, but fails with err. The imap, smtp and lmtp protocols return
+// ErrProtocol for servers without STARTTLS, as imap and smtp always did.
+func expectCapabilityErr(has func(lines []string) bool, err error) textCheck {
+	return func(rep *textReply) error {
+		if !has(rep.lines) {
+			return err
+		}
+		return nil
+	}
+}
+
+// hasWord returns a capability test that looks for word as a separate, case insensitive field in any line.
+func hasWord(word string) func(lines []string) bool {
+	return func(lines []string) bool {
+		for _, l := range lines {
+			for _, f := range strings.Fields(l) {
+				if strings.EqualFold(f, word) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,120 @@
+package certexpire
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// textServer writes the lines of greeting, then answers each command with the next entry of replies.
+func textServer(t *testing.T, greeting string, replies ...string) string {
+	return textServerTLS(t, nil, greeting, replies...)
+}
+
+// textServerTLS is like textServer, but runs the TLS handshake with cert after the last reply.
+func textServerTLS(t *testing.T, cert *testCert, greeting string, replies ...string) string {
+	return fakeServer(t, func(conn net.Conn) {
+		if _, err := conn.Write([]byte(greeting)); err != nil {
+			return
+		}
+		r := NewLineReader(conn)
+		for _, rep := range replies {
+			if _, err := r.Line(); err != nil {
+				return
+			}
+			if _, err := conn.Write([]byte(rep)); err != nil {
+				return
+			}
+		}
+		if cert != nil {
+			serveTLS(conn, cert.TLS())
+		}
+	})
+}
+
+func TestNoStartTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tests := []struct {
+		name  string
+		fetch func(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error)
+		port  string
+		err   error
+	}{
+		{"imap", GetCertIMAPContext, textServer(t, "* OK [CAPABILITY IMAP4rev1] ready\r\n"), ErrProtocol},
+		{"smtp", GetCertSMTPContext, textServer(t, "220 ready\r\n", "250-mx\r\n250 8BITMIME\r\n"), ErrProtocol},
+		{"lmtp", GetCertLMTPContext, textServer(t, "220 ready\r\n", "250-mx\r\n250 8BITMIME\r\n"), ErrProtocol},
+		{"pop3", GetCertPOP3Context, textServer(t, "+OK ready\r\n", "+OK\r\nUSER\r\n.\r\n"), ErrNoTLS},
+		{"nntp", GetCertNNTPContext, textServer(t, "200 ready\r\n", "101 list\r\nVERSION 2\r\n.\r\n"), ErrNoTLS},
+	}
+	for _, test := range tests {
+		if _, err := test.fetch(ctx, "localhost", test.port, nil); err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tests := []struct {
+		name  string
+		fetch func(ctx context.Context, servername, port string, proxy *Proxy) (*CertValues, error)
+		port  string
+	}{
+		{"imap", GetCertIMAPContext, textServerTLS(t, cert, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n", "001 OK Begin TLS\r\n")},
+		{"smtp", GetCertSMTPContext, textServerTLS(t, cert, "220 ready\r\n", "250-mx\r\n250-STARTTLS\r\n250 8BITMIME\r\n", "220 go ahead\r\n")},
+		{"lmtp", GetCertLMTPContext, textServerTLS(t, cert, "220 ready\r\n", "250-lmtp\r\n250 STARTTLS\r\n", "220 go ahead\r\n")},
+		{"pop3", GetCertPOP3Context, textServerTLS(t, cert, "+OK ready\r\n", "+OK\r\nUSER\r\nSTLS\r\n.\r\n", "+OK Begin TLS\r\n")},
+		{"nntp", GetCertNNTPContext, textServerTLS(t, cert, "200 ready\r\n", "101 list\r\nVERSION 2\r\nSTARTTLS\r\n.\r\n", "382 Continue\r\n")},
+		{"nntp-no-capabilities", GetCertNNTPContext, textServerTLS(t, cert, "201 ready\r\n", "500 unknown\r\n", "382 Continue\r\n")},
+		{"sieve", GetCertSieveContext, textServerTLS(t, cert, "\"IMPLEMENTATION\" \"test\"\r\n\"SASL\" \"\"\r\n\"STARTTLS\"\r\nOK \"ready\"\r\n", "OK \"Begin TLS\"\r\n")},
+	}
+	for _, test := range tests {
+		cv, err := test.fetch(ctx, "localhost", test.port, nil)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if cv.Certificate == nil || !cv.Certificate.Equal(cert.Cert) {
+			t.Errorf("%s: wrong certificate", test.name)
+		}
+	}
+	noTLS := textServer(t, "\"IMPLEMENTATION\" \"test\"\r\nOK\r\n")
+	if _, err := GetCertSieveContext(ctx, "localhost", noTLS, nil); err != ErrNoTLS {
+		t.Errorf("sieve without STARTTLS: got error %v, want %v", err, ErrNoTLS)
+	}
+	refused := textServer(t, "\"STARTTLS\"\r\nOK\r\n", "NO \"not now\"\r\n")
+	if _, err := GetCertSieveContext(ctx, "localhost", refused, nil); err != ErrProtocol {
+		t.Errorf("sieve refused: got error %v, want %v", err, ErrProtocol)
+	}
+}
+
+func TestReadTagged(t *testing.T) {
+	tests := []struct {
+		reply string
+		code  string
+		lines int
+	}{
+		{"\"IMPLEMENTATION\" \"x\"\r\n\"STARTTLS\"\r\nOK\r\n", "OK", 3},
+		{"ok \"done\"\r\n", "OK", 1},
+		{"NO \"denied\"\r\n", "NO", 1},
+		{"\"A\"\r\n\r\nBYE \"shutdown\"\r\n", "BYE", 3},
+	}
+	for _, test := range tests {
+		rep, err := readTagged(NewLineReader(strings.NewReader(test.reply)))
+		if err != nil {
+			t.Errorf("%q: %s", test.reply, err)
+			continue
+		}
+		if rep.code != test.code || len(rep.lines) != test.lines {
+			t.Errorf("%q: got %s %q", test.reply, rep.code, rep.lines)
+		}
+	}
+	if _, err := readTagged(NewLineReader(strings.NewReader("\"STARTTLS\"\r\n"))); err == nil {
+		t.Error("no status: no error")
+	}
+}
@@ -0,0 +1,73 @@
+package certexpire
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// Trust modes, selecting the roots network certificates are verified against.
+const (
+	TrustDefault = ""        // TrustAppend if a CA file is set, TrustSystem otherwise.
+	TrustSystem  = "system"  // The system roots only. The CA file is ignored.
+	TrustAppend  = "append"  // The system roots and the certificates of the CA file.
+	TrustReplace = "replace" // The certificates of the CA file only.
+	TrustNone    = "none"    // The chain is not verified. Expiry, hostname and hash are still checked.
+)
+
+var (
+	poolLock sync.Mutex
+	pools    = make(map[string]*x509.CertPool)
+)
+
+// loadPool returns the pool of roots for CA file caFile and mode. Pools are loaded once and shared by all checks.
+func loadPool(caFile, mode string) (*x509.CertPool, error) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	key := mode + ":" + caFile
+	if p, ok := pools[key]; ok {
+		return p, nil
+	}
+	var pool *x509.CertPool
+	if mode == TrustReplace {
+		pool = x509.NewCertPool()
+	} else {
+		p, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		pool = p
+	}
+	if mode != TrustSystem {
+		d, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := parseCerts(d, &Options{})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range certs {
+			pool.AddCert(c)
+		}
+	}
+	pools[key] = pool
+	return pool, nil
+}
+
+// rootPool returns the roots to verify network certificates against. A nil pool means no verification.
+func (o *Options) rootPool() (*x509.CertPool, error) {
+	mode := o.Trust
+	switch {
+	case mode == TrustNone:
+		return nil, nil
+	case mode == TrustDefault && o.CAFile != "":
+		mode = TrustAppend
+	case mode == TrustDefault || (mode == TrustAppend && o.CAFile == ""):
+		mode = TrustSystem
+	case mode == TrustReplace && o.CAFile == "":
+		return nil, errors.New("certexpire: trust=replace without CA file")
+	}
+	return loadPool(o.CAFile, mode)
+}
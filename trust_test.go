@@ -0,0 +1,125 @@
+package certexpire
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRootPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	leaf, inter, root := testChain(t, "example.com")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, root.PEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	verifies := func(pool *x509.CertPool) bool {
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(inter.Cert)
+		_, err := leaf.Cert.Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediates, DNSName: "example.com"})
+		return err == nil
+	}
+
+	tests := []struct {
+		name    string
+		options Options
+		err     bool
+		nilPool bool // No verification.
+		verify  bool // The test root is trusted.
+	}{
+		{"default", Options{}, false, false, false},
+		{"default-cafile", Options{CAFile: caFile}, false, false, true},
+		{"system", Options{Trust: TrustSystem, CAFile: caFile}, false, false, false},
+		{"append", Options{Trust: TrustAppend, CAFile: caFile}, false, false, true},
+		{"append-no-cafile", Options{Trust: TrustAppend}, false, false, false},
+		{"replace", Options{Trust: TrustReplace, CAFile: caFile}, false, false, true},
+		{"replace-no-cafile", Options{Trust: TrustReplace}, true, false, false},
+		{"none", Options{Trust: TrustNone, CAFile: caFile}, false, true, false},
+		{"missing-cafile", Options{CAFile: filepath.Join(dir, "missing.pem")}, true, false, false},
+	}
+	for _, test := range tests {
+		pool, err := test.options.rootPool()
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if (pool == nil) != test.nilPool {
+			t.Errorf("%s: got pool %v", test.name, pool)
+			continue
+		}
+		if pool != nil && verifies(pool) != test.verify {
+			t.Errorf("%s: test root trusted: %t, want %t", test.name, !test.verify, test.verify)
+		}
+	}
+
+	replace, err := (&Options{Trust: TrustReplace, CAFile: caFile}).rootPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(replace.Subjects()); n != 1 {
+		t.Errorf("replace: got %d roots, want only the test root", n)
+	}
+	// Pools are cached by mode and file.
+	if p, _ := (&Options{Trust: TrustReplace, CAFile: caFile}).rootPool(); p != replace {
+		t.Error("replace: pool loaded again")
+	}
+	if p, _ := (&Options{Trust: TrustAppend, CAFile: caFile}).rootPool(); p == replace {
+		t.Error("append: got the pool of replace")
+	}
+	if p, _ := (&Options{CAFile: caFile}).rootPool(); p != pools[TrustAppend+":"+caFile] {
+		t.Error("default with cafile: not the pool of append")
+	}
+	other := filepath.Join(dir, "other.pem")
+	if err := ioutil.WriteFile(other, newTestCert(t, "Other Root", time.Now().Add(time.Hour), nil).PEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := (&Options{Trust: TrustReplace, CAFile: other}).rootPool(); p == replace || verifies(p) {
+		t.Error("replace with other cafile: got the pool of the first cafile")
+	}
+}
+
+func TestParseConfigCAFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certexpire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, newTestCert(t, "Test Root", time.Now().Add(time.Hour), nil).PEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, errs, err := ParseConfig(`example.com:443:tls:10d
+^"` + caFile + `"
+example.com:443:tls:10d
+example.com:443:tls:10d:ca=/etc/ssl/other.pem
+^system
+example.com:443:tls:10d
+`)
+	if err != nil {
+		t.Fatalf("%s: %v", err, errs)
+	}
+	checks := c.Tests[0].Checks
+	if len(checks) != 4 {
+		t.Fatalf("got %d checks", len(checks))
+	}
+	for i, want := range []string{"", caFile, "/etc/ssl/other.pem", ""} {
+		if checks[i].Options.CAFile != want {
+			t.Errorf("check %d: got cafile %q, want %q", i, checks[i].Options.CAFile, want)
+		}
+	}
+
+	_, errs, err = ParseConfig("^" + filepath.Join(dir, "missing.pem") + "\nexample.com:443:tls:10d\n")
+	if err == nil || len(errs) != 1 {
+		t.Errorf("missing cafile: got errors %v", errs)
+	}
+}
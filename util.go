@@ -9,11 +9,20 @@ import (
 )
 
 var (
-	ErrProtocol = errors.New("certexpire: protocol error")
-	ErrNoCert   = errors.New("certexpire: no certificate")
-	ErrConfig   = errors.New("certexpire: configuration error")
-	ErrHash     = errors.New("Hash does not match")
-	ErrExpire   = errors.New("Expiration warning")
+	ErrProtocol   = errors.New("certexpire: protocol error")
+	ErrNoCert     = errors.New("certexpire: no certificate")
+	ErrNoTLS      = errors.New("certexpire: server does not support TLS")
+	ErrConfig     = errors.New("certexpire: configuration error")
+	ErrAddrsProxy = errors.New("certexpire: addrs=all cannot be used with a proxy")
+	ErrHash       = errors.New("Hash does not match")
+	ErrPin        = errors.New("Pin does not match")
+	ErrExpire     = errors.New("Expiration warning")
+	ErrMismatch   = errors.New("Certificate differs between addresses")
+
+	ErrRevoked          = errors.New("Certificate revoked")
+	ErrOCSPUnknown      = errors.New("OCSP status unknown")
+	ErrOCSPNoStaple     = errors.New("No stapled OCSP response")
+	ErrOCSPStapleExpire = errors.New("Stapled OCSP response expires soon")
 )
 
 // LineReader helps with dealing with text protocols on the network.
@@ -58,7 +67,10 @@ func (lr LineReader) ReadNumeric() (code, message string, cont bool, err error)
 }
 
 // ReadNumericContinuous continues to read until the server expects a message.
+// Multi-line replies end with a line carrying the code of the first line without continuation mark.
+// Lines in between may omit the code, as FTP does.
 func (lr LineReader) ReadNumericContinuous() (code string, messages []string, err error) {
+	var first string
 	messages = make([]string, 0, 1)
 ReadLoop:
 	for {
@@ -67,9 +79,58 @@ ReadLoop:
 			return "", messages, err
 		}
 		messages = append(messages, message)
+		if len(messages) == 1 {
+			first = code
+		} else if code != first {
+			continue ReadLoop
+		}
 		if cont {
 			continue ReadLoop
 		}
 		return code, messages, nil
 	}
 }
+
+// splitArgs splits a command line into arguments at whitespace. Single and double quotes group words,
+// a backslash outside of single quotes escapes the next character.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args          []string
+		b             bytes.Buffer
+		inArg, escape bool
+		quote         rune
+	)
+	for _, c := range s {
+		switch {
+		case escape:
+			b.WriteRune(c)
+			escape = false
+		case c == '\\' && quote != '\'':
+			escape, inArg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				b.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteRune(c)
+			inArg = true
+		}
+	}
+	if escape || quote != 0 {
+		return nil, errors.New("certexpire: unterminated quote or escape in command")
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,71 @@
+package certexpire
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+	}{
+		{"openssl x509 -in cert.pem", []string{"openssl", "x509", "-in", "cert.pem"}},
+		{"  cat   a  ", []string{"cat", "a"}},
+		{"", nil},
+		{`cat "a b" 'c d'`, []string{"cat", "a b", "c d"}},
+		{`cat a\ b`, []string{"cat", "a b"}},
+		{`cat "a\"b" 'a\b'`, []string{"cat", `a"b`, `a\b`}},
+		{`cat "" x''y`, []string{"cat", "", "xy"}},
+	}
+	for _, test := range tests {
+		args, err := splitArgs(test.command)
+		if err != nil {
+			t.Errorf("%q: %s", test.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q: got %q, want %q", test.command, args, test.args)
+		}
+	}
+	for _, command := range []string{`cat "a`, `cat 'a`, `cat a\`} {
+		if _, err := splitArgs(command); err == nil {
+			t.Errorf("%q: no error", command)
+		}
+	}
+}
+
+func TestReadNumericContinuous(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		code     string
+		messages int
+	}{
+		{"single", "220 ready\r\n", "220", 1},
+		{"smtp", "250-mx.example.com\r\n250-STARTTLS\r\n250 8BITMIME\r\n", "250", 3},
+		{"ftp", "211-Features:\r\n AUTH TLS\r\n PBSZ\r\n211 End\r\n", "211", 4},
+		// A line with a different code does not end the reply, only the code of the first line does.
+		{"mismatched-code", "211-Features:\r\n220 not the end\r\n211 End\r\n", "211", 3},
+		{"mismatched-continuation", "211-Features:\r\n211-More\r\n211 End\r\n", "211", 3},
+	}
+	for _, test := range tests {
+		r := NewLineReader(strings.NewReader(test.reply + "999 next reply\r\n"))
+		code, messages, err := r.ReadNumericContinuous()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if code != test.code || len(messages) != test.messages {
+			t.Errorf("%s: got %s %q", test.name, code, messages)
+		}
+		if code, _, _ := r.ReadNumericContinuous(); code != "999" {
+			t.Errorf("%s: next reply has code %s", test.name, code)
+		}
+	}
+	r := NewLineReader(strings.NewReader("211-Features:\r\n220 not the end\r\n"))
+	if _, _, err := r.ReadNumericContinuous(); err == nil {
+		t.Error("unterminated reply: no error")
+	}
+}
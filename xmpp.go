@@ -0,0 +1,159 @@
+package certexpire
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	xmppNSStream = "http://etherx.jabber.org/streams"
+	xmppNSTLS    = "urn:ietf:params:xml:ns:xmpp-tls"
+	xmppNSClient = "jabber:client"
+	xmppNSServer = "jabber:server"
+)
+
+// XMLStreamReader reads top level elements from streaming XML protocols like XMPP,
+// where the document is never completed.
+type XMLStreamReader struct {
+	d *xml.Decoder
+}
+
+// NewXMLStreamReader returns r as an XMLStreamReader. At most 65536 bytes are read from r.
+func NewXMLStreamReader(r io.Reader) *XMLStreamReader {
+	return &XMLStreamReader{d: xml.NewDecoder(
+		&io.LimitedReader{
+			R: r,
+			N: 65536,
+		})}
+}
+
+// Start returns the next start element, skipping character data, comments and processing instructions.
+func (xr XMLStreamReader) Start() (*xml.StartElement, error) {
+	for {
+		t, err := xr.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch e := t.(type) {
+		case xml.StartElement:
+			return &e, nil
+		case xml.EndElement:
+			return nil, ErrProtocol
+		}
+	}
+}
+
+// Element decodes the element started by start into v.
+func (xr XMLStreamReader) Element(v interface{}, start *xml.StartElement) error {
+	return xr.d.DecodeElement(v, start)
+}
+
+type xmppFeatures struct {
+	StartTLS *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+}
+
+type xmppStreamError struct {
+	Inner struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func xmppOpenStream(domain, ns string) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString("<?xml version='1.0'?><stream:stream to='")
+	_ = xml.EscapeText(b, []byte(domain))
+	fmt.Fprintf(b, "' version='1.0' xmlns='%s' xmlns:stream='%s'>", ns, xmppNSStream)
+	return b.Bytes()
+}
+
+// xmppStreamErr converts a <stream:error/> into an error.
+func xmppStreamErr(r *XMLStreamReader, e *xml.StartElement) error {
+	se := new(xmppStreamError)
+	if err := r.Element(se, e); err != nil {
+		return err
+	}
+	return fmt.Errorf("certexpire: xmpp stream error: %s", se.Inner.XMLName.Local)
+}
+
+func xmppprelude(conn net.Conn, domain, ns string) error {
+	_, err := conn.Write(xmppOpenStream(domain, ns))
+	if err != nil {
+		return err
+	}
+	r := NewXMLStreamReader(conn)
+	e, err := r.Start()
+	if err != nil {
+		return err
+	}
+	if e.Name.Space != xmppNSStream || e.Name.Local != "stream" {
+		return ErrProtocol
+	}
+	if e, err = r.Start(); err != nil {
+		return err
+	}
+	if e.Name.Space == xmppNSStream && e.Name.Local == "error" {
+		return xmppStreamErr(r, e)
+	}
+	if e.Name.Space != xmppNSStream || e.Name.Local != "features" {
+		return ErrProtocol
+	}
+	features := new(xmppFeatures)
+	if err := r.Element(features, e); err != nil {
+		return err
+	}
+	if features.StartTLS == nil {
+		return ErrNoTLS
+	}
+	_, err = conn.Write([]byte("<starttls xmlns='" + xmppNSTLS + "'/>"))
+	if err != nil {
+		return err
+	}
+	if e, err = r.Start(); err != nil {
+		return err
+	}
+	switch {
+	case e.Name.Space == xmppNSTLS && e.Name.Local == "proceed":
+		return nil
+	case e.Name.Space == xmppNSStream && e.Name.Local == "error":
+		return xmppStreamErr(r, e)
+	default:
+		return ErrProtocol
+	}
+}
+
+// GetCertXMPP returns the expiration date of an XMPP STARTTLS cert. Server selects server-to-server streams.
+func GetCertXMPP(servername, port string, server bool, timeout time.Duration, proxy *Proxy) (*CertValues, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return GetCertXMPPContext(ctx, servername, port, server, proxy)
+}
+
+// GetCertXMPPContext is like GetCertXMPP, but the retrieval is aborted when ctx is done.
+func GetCertXMPPContext(ctx context.Context, servername, port string, server bool, proxy *Proxy) (*CertValues, error) {
+	return getCertXMPP(ctx, newTarget(servername, port, proxy), server)
+}
+
+// getCertXMPP opens the stream to the domain the certificate is verified for.
+func getCertXMPP(ctx context.Context, t *Target, server bool) (*CertValues, error) {
+	ns := xmppNSClient
+	if server {
+		ns = xmppNSServer
+	}
+	return getCertPrelude(ctx, t, func(conn net.Conn) error {
+		return xmppprelude(conn, t.verifyName(), ns)
+	})
+}
+
+func init() {
+	RegisterProtocol("xmpp-client", FetcherFunc(func(ctx context.Context, t *Target) (*CertValues, error) {
+		return getCertXMPP(ctx, t, false)
+	}))
+	RegisterProtocol("xmpp-server", FetcherFunc(func(ctx context.Context, t *Target) (*CertValues, error) {
+		return getCertXMPP(ctx, t, true)
+	}))
+}
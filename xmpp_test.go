@@ -0,0 +1,94 @@
+package certexpire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const xmppStreamHeader = "<?xml version='1.0'?><stream:stream from='localhost' id='1' version='1.0' " +
+	"xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'>"
+
+// xmppServer answers the stream header with features and, if the client asks for STARTTLS, with reply.
+// The TLS handshake with cert follows a <proceed/> reply.
+func xmppServer(t *testing.T, features, reply string, cert *testCert) string {
+	return fakeServer(t, func(conn net.Conn) {
+		r := NewXMLStreamReader(conn)
+		e, err := r.Start()
+		if err != nil || e.Name.Local != "stream" {
+			return
+		}
+		if _, err := conn.Write([]byte(xmppStreamHeader + features)); err != nil {
+			return
+		}
+		if e, err = r.Start(); err != nil || e.Name.Space != xmppNSTLS || e.Name.Local != "starttls" {
+			return
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+		if strings.Contains(reply, "proceed") {
+			serveTLS(conn, cert.TLS())
+		}
+	})
+}
+
+func TestXMPP(t *testing.T) {
+	cert := newTestCert(t, "localhost", time.Now().Add(24*time.Hour), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	starttls := "<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls>" +
+		"<mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>PLAIN</mechanism></mechanisms></stream:features>"
+	proceed := "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"
+
+	for _, server := range []bool{false, true} {
+		cv, err := GetCertXMPPContext(ctx, "localhost", xmppServer(t, starttls, proceed, cert), server, nil)
+		if err != nil {
+			t.Fatalf("proceed: %s", err)
+		}
+		if cv.Certificate == nil || !cv.Certificate.Equal(cert.Cert) {
+			t.Error("proceed: wrong certificate")
+		}
+	}
+
+	noTLS := "<stream:features><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'/></stream:features>"
+	if _, err := GetCertXMPPContext(ctx, "localhost", xmppServer(t, noTLS, "", cert), false, nil); !errors.Is(err, ErrNoTLS) {
+		t.Errorf("no starttls: got error %v, want %v", err, ErrNoTLS)
+	}
+	failure := "<failure xmlns='urn:ietf:params:xml:ns:xmpp-tls'/></stream:stream>"
+	if _, err := GetCertXMPPContext(ctx, "localhost", xmppServer(t, starttls, failure, cert), false, nil); !errors.Is(err, ErrProtocol) {
+		t.Errorf("failure: got error %v, want %v", err, ErrProtocol)
+	}
+	streamErr := "<stream:error><host-unknown xmlns='urn:ietf:params:xml:ns:xmpp-streams'/></stream:error></stream:stream>"
+	_, err := GetCertXMPPContext(ctx, "localhost", xmppServer(t, streamErr, "", cert), false, nil)
+	if err == nil || !strings.Contains(err.Error(), "host-unknown") {
+		t.Errorf("stream error: got error %v", err)
+	}
+	_, err = GetCertXMPPContext(ctx, "localhost", xmppServer(t, starttls, streamErr, cert), false, nil)
+	if err == nil || !strings.Contains(err.Error(), "host-unknown") {
+		t.Errorf("stream error after starttls: got error %v", err)
+	}
+}
+
+func TestXMLStreamReader(t *testing.T) {
+	r := NewXMLStreamReader(strings.NewReader("<?xml version='1.0'?>\n<!-- c --><a>text<b/></a>"))
+	for _, name := range []string{"a", "b"} {
+		e, err := r.Start()
+		if err != nil || e.Name.Local != name {
+			t.Fatalf("got %v, %v, want %s", e, err, name)
+		}
+	}
+	if _, err := r.Start(); err != ErrProtocol {
+		t.Errorf("end element: got error %v, want %v", err, ErrProtocol)
+	}
+	r = NewXMLStreamReader(strings.NewReader("<a>" + strings.Repeat("x", 70000) + "<b/>"))
+	if _, err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Start(); err == nil {
+		t.Error("oversized stream: no error")
+	}
+}